@@ -9,7 +9,6 @@ import (
 	"gorm.io/driver/postgres"
 	"gorm.io/gorm"
 
-	"github.com/Pritam-deb/echo-sense/db/models"
 	_ "github.com/lib/pq" // needed for sql.Open
 )
 
@@ -71,11 +70,6 @@ func Connect() {
 		log.Fatal("Failed to connect to database: ", err)
 	}
 
-	// Run migrations
-	err = DB.AutoMigrate(&models.Song{}, &models.AudioFingerprint{})
-	if err != nil {
-		log.Fatal("Failed to run migrations: ", err)
-	}
-
 	log.Println("Database connection successful 🚀")
+	warnIfPendingMigrations()
 }
@@ -0,0 +1,168 @@
+package db
+
+import (
+	"github.com/Pritam-deb/echo-sense/db/models"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+// Postgres caps the number of bind parameters per statement, so large
+// lookups are split into chunks of this size.
+const lookupBatchSize = 10000
+
+// GetFingerprintsByHashes returns every stored fingerprint whose hash is one
+// of the given hashes and whose song was fingerprinted with the spectrogram
+// config identified by configKey and the given hash layout version. Hashes
+// from other configs or layouts mean different things, so they are never
+// returned together.
+func GetFingerprintsByHashes(hashes []int64, configKey string, hashVersion int) ([]models.AudioFingerprint, error) {
+	var fingerprints []models.AudioFingerprint
+	for start := 0; start < len(hashes); start += lookupBatchSize {
+		end := start + lookupBatchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		var batch []models.AudioFingerprint
+		err := DB.Joins("JOIN songs ON songs.id = audio_fingerprints.song_id").
+			Where("audio_fingerprints.hash IN ? AND songs.spectrogram_config = ? AND songs.hash_version = ?", hashes[start:end], configKey, hashVersion).
+			Find(&batch).Error
+		if err != nil {
+			return nil, err
+		}
+		fingerprints = append(fingerprints, batch...)
+	}
+	return fingerprints, nil
+}
+
+// GetSongByID loads a single song by its primary key.
+func GetSongByID(id uuid.UUID) (*models.Song, error) {
+	var song models.Song
+	if err := DB.First(&song, "id = ?", id).Error; err != nil {
+		return nil, err
+	}
+	return &song, nil
+}
+
+// Each fingerprint row binds six parameters, so this keeps a multi-row
+// insert well under Postgres' 65535 parameter limit.
+const insertBatchSize = 5000
+
+// SaveSongWithFingerprints inserts a song and the fingerprints produced by
+// fill in a single transaction. fill is handed an insert function to call
+// once per fingerprint; rows are buffered and written insertBatchSize at a
+// time with their SongID set from the saved song, so memory stays bounded
+// however many fingerprints a song has. Changes fill makes to the song, such
+// as its duration, are saved once it returns. If fill or any batch fails, the
+// song row is rolled back as well so no unsearchable songs are left behind.
+func SaveSongWithFingerprints(song *models.Song, fill func(insert func(models.AudioFingerprint) error) error) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(song).Error; err != nil {
+			return err
+		}
+		return insertFingerprints(tx, song, fill)
+	})
+}
+
+// ReplaceSongFingerprints swaps a stored song's fingerprints for the ones
+// fill produces, as SaveSongWithFingerprints does for new songs. The old
+// fingerprints stay in place until the transaction commits, so the song
+// remains searchable if regenerating fails.
+func ReplaceSongFingerprints(song *models.Song, fill func(insert func(models.AudioFingerprint) error) error) error {
+	return DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("song_id = ?", song.ID).Delete(&models.AudioFingerprint{}).Error; err != nil {
+			return err
+		}
+		return insertFingerprints(tx, song, fill)
+	})
+}
+
+// insertFingerprints writes the fingerprints fill produces for song in
+// batches, then saves the song itself.
+func insertFingerprints(tx *gorm.DB, song *models.Song, fill func(insert func(models.AudioFingerprint) error) error) error {
+	batch := make([]models.AudioFingerprint, 0, insertBatchSize)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := tx.Create(&batch).Error
+		batch = batch[:0]
+		return err
+	}
+	insert := func(fingerprint models.AudioFingerprint) error {
+		fingerprint.SongID = song.ID
+		batch = append(batch, fingerprint)
+		if len(batch) < insertBatchSize {
+			return nil
+		}
+		return flush()
+	}
+	if err := fill(insert); err != nil {
+		return err
+	}
+	if err := flush(); err != nil {
+		return err
+	}
+	return tx.Save(song).Error
+}
+
+// FindStaleSongs returns the songs whose fingerprints GetFingerprintsByHashes
+// no longer returns for configKey and hashVersion: those using an older hash
+// layout or computed with another spectrogram config.
+func FindStaleSongs(configKey string, hashVersion int) ([]models.Song, error) {
+	var songs []models.Song
+	query := DB.Where("hash_version < ? OR spectrogram_config IS NULL OR spectrogram_config <> ?", hashVersion, configKey)
+	if err := query.Order("title").Find(&songs).Error; err != nil {
+		return nil, err
+	}
+	return songs, nil
+}
+
+// ListSongs returns songs ordered by title. A limit of zero or less returns
+// every song.
+func ListSongs(limit, offset int) ([]models.Song, error) {
+	var songs []models.Song
+	query := DB.Order("title").Offset(offset)
+	if limit > 0 {
+		query = query.Limit(limit)
+	}
+	if err := query.Find(&songs).Error; err != nil {
+		return nil, err
+	}
+	return songs, nil
+}
+
+// DeleteSong removes a song; its fingerprints go with it through the
+// ON DELETE CASCADE foreign key. It reports whether a song was deleted.
+func DeleteSong(id uuid.UUID) (bool, error) {
+	result := DB.Delete(&models.Song{}, "id = ?", id)
+	if result.Error != nil {
+		return false, result.Error
+	}
+	return result.RowsAffected > 0, nil
+}
+
+// FindSongs returns the songs matching a single column, e.g. "song_key" or
+// "artist".
+func FindSongs(column, value string) ([]models.Song, error) {
+	var songs []models.Song
+	if err := DB.Where(map[string]any{column: value}).Find(&songs).Error; err != nil {
+		return nil, err
+	}
+	return songs, nil
+}
+
+// DeleteSongs removes the given songs and, through the cascade, their
+// fingerprints. It returns the number of songs deleted.
+func DeleteSongs(ids []uuid.UUID) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+	result := DB.Where("id IN ?", ids).Delete(&models.Song{})
+	return result.RowsAffected, result.Error
+}
+
+// DeleteAllSongs empties the library. It returns the number of songs deleted.
+func DeleteAllSongs() (int64, error) {
+	result := DB.Session(&gorm.Session{AllowGlobalUpdate: true}).Delete(&models.Song{})
+	return result.RowsAffected, result.Error
+}
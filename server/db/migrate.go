@@ -0,0 +1,72 @@
+package db
+
+import (
+	"embed"
+	"fmt"
+	"log"
+
+	"github.com/pressly/goose/v3"
+)
+
+//go:embed migrations/*.sql
+var migrationsFS embed.FS
+
+const migrationsDir = "migrations"
+
+func setupGoose() error {
+	goose.SetBaseFS(migrationsFS)
+	return goose.SetDialect("postgres")
+}
+
+// Migrate runs a goose command against the embedded migrations. The
+// migrations are the only place the schema is defined; the GORM models
+// mirror them.
+func Migrate(command string) error {
+	if err := setupGoose(); err != nil {
+		return err
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+
+	switch command {
+	case "up":
+		// The initial create-tables migration was added after databases had
+		// already been set up by AutoMigrate, so allow applying it late.
+		return goose.Up(sqlDB, migrationsDir, goose.WithAllowMissing())
+	case "down":
+		return goose.Down(sqlDB, migrationsDir)
+	case "status":
+		return goose.Status(sqlDB, migrationsDir)
+	default:
+		return fmt.Errorf("unknown migrate command %q, expected one of: up, down, status", command)
+	}
+}
+
+// warnIfPendingMigrations logs a hint when the database schema is behind the
+// embedded migrations, since the schema is no longer created on startup.
+func warnIfPendingMigrations() {
+	if err := setupGoose(); err != nil {
+		return
+	}
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return
+	}
+	current, err := goose.GetDBVersion(sqlDB)
+	if err != nil {
+		return
+	}
+	migrations, err := goose.CollectMigrations(migrationsDir, 0, goose.MaxVersion)
+	if err != nil || len(migrations) == 0 {
+		return
+	}
+	latest, err := migrations.Last()
+	if err != nil {
+		return
+	}
+	if current < latest.Version {
+		log.Printf("Database schema is at version %d but %d is available, run 'migrate up' ⚠️", current, latest.Version)
+	}
+}
@@ -0,0 +1,25 @@
+-- +goose Up
+CREATE TABLE IF NOT EXISTS songs (
+    id UUID PRIMARY KEY,
+    title TEXT,
+    artist TEXT,
+    album TEXT,
+    youtube_id TEXT,
+    song_key TEXT,
+    duration BIGINT,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+CREATE TABLE IF NOT EXISTS audio_fingerprints (
+    id UUID PRIMARY KEY,
+    address BIGINT,
+    anchor_time BIGINT,
+    song_id UUID REFERENCES songs(id) ON UPDATE CASCADE ON DELETE CASCADE,
+    created_at TIMESTAMPTZ,
+    updated_at TIMESTAMPTZ
+);
+
+-- +goose Down
+DROP TABLE IF EXISTS audio_fingerprints;
+DROP TABLE IF EXISTS songs;
@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS spectrogram_config TEXT;
+-- Every song stored so far was fingerprinted with the default config.
+UPDATE songs SET spectrogram_config = 'hamming-1024-32-11025' WHERE spectrogram_config IS NULL;
+CREATE INDEX IF NOT EXISTS idx_songs_spectrogram_config ON songs(spectrogram_config);
+
+-- +goose Down
+DROP INDEX IF EXISTS idx_songs_spectrogram_config;
+ALTER TABLE songs DROP COLUMN IF EXISTS spectrogram_config;
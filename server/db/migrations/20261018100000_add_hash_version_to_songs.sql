@@ -0,0 +1,9 @@
+-- +goose Up
+ALTER TABLE songs ADD COLUMN IF NOT EXISTS hash_version INTEGER;
+-- Every song stored so far used the first hash layout, whose time deltas
+-- were truncated to whole seconds; `reindex` regenerates them.
+UPDATE songs SET hash_version = 1 WHERE hash_version IS NULL;
+ALTER TABLE songs ALTER COLUMN hash_version SET NOT NULL;
+
+-- +goose Down
+ALTER TABLE songs DROP COLUMN IF EXISTS hash_version;
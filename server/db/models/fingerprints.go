@@ -9,8 +9,8 @@ import (
 
 type AudioFingerprint struct {
 	ID         uuid.UUID `gorm:"type:uuid;primaryKey"`
-	Address    int
-	AnchorTime int
+	Hash       int64
+	AnchorTime float64   // seconds from the start of the song
 	SongID     uuid.UUID `gorm:"type:uuid"`
 	Song       Song      `gorm:"foreignKey:SongID;constraint:OnUpdate:CASCADE,OnDelete:CASCADE;"`
 	CreatedAt  time.Time
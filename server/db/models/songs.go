@@ -8,15 +8,19 @@ import (
 )
 
 type Song struct {
-	ID        uuid.UUID `gorm:"type:uuid;primaryKey"`
-	Title     string
-	Artist    string
-	Album     string
-	YoutubeID string
-	SongKey   string
-	Duration  int
-	CreatedAt time.Time
-	UpdatedAt time.Time
+	ID        uuid.UUID `gorm:"type:uuid;primaryKey" json:"id"`
+	Title     string    `json:"title"`
+	Artist    string    `json:"artist"`
+	Album     string    `json:"album"`
+	YoutubeID string    `json:"youtube_id"`
+	SongKey   string    `json:"song_key"`
+	Duration  int       `json:"duration"`
+	// Key of the recognisingalgorithm.SpectrogramConfig the fingerprints were computed with
+	SpectrogramConfig string `json:"spectrogram_config"`
+	// recognisingalgorithm.HashVersion of the layout the fingerprints' hashes use
+	HashVersion int       `json:"hash_version"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
 }
 
 // Generate UUID before inserting
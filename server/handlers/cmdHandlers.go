@@ -2,30 +2,448 @@ package handlers
 
 import (
 	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
 	"log/slog"
+	"math"
+	"os"
+	"path/filepath"
+	"runtime"
 	"strings"
+	"sync"
+	"sync/atomic"
 
+	"github.com/Pritam-deb/echo-sense/db"
+	"github.com/Pritam-deb/echo-sense/db/models"
+	recognisingalgorithm "github.com/Pritam-deb/echo-sense/internals/recognisingAlgorithm"
+	songservice "github.com/Pritam-deb/echo-sense/internals/songService"
 	"github.com/Pritam-deb/echo-sense/internals/spotify"
+	"github.com/Pritam-deb/echo-sense/pkg"
 	"github.com/Pritam-deb/echo-sense/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
 )
 
 const SONGS_DIR = "songs"
+const TEMP_DIR = "temporary_files"
 
 func Download(url string) {
-	//Song download logic will be here
+	switch spotify.URLKind(url) {
+	case "track":
+		spotify.DownloadSingleTrack(url)
+	case "album":
+		spotify.DownloadAlbum(url)
+	case "playlist":
+		spotify.DownloadPlaylist(url)
+	default:
+		fmt.Println("Expected a Spotify track, album or playlist URL.")
+	}
+}
 
-	err := utils.CreateDirIfNotExist(SONGS_DIR)
-	if err != nil {
+func Migrate(command string) {
+	if err := db.Migrate(command); err != nil {
 		logger := utils.GetLogger()
 		ctx := context.Background()
-		logger.ErrorContext(ctx, "Failed to create directory for songs", slog.Any("error", err))
+		logger.ErrorContext(ctx, "Failed to run migrations", slog.Any("error", err), slog.String("command", command))
+		os.Exit(1)
+	}
+}
+
+func Search(wavPath string) {
+	logger := utils.GetLogger()
+	ctx := context.Background()
+
+	fingerprints, err := fingerprintClip(wavPath)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to fingerprint clip", slog.Any("error", err), slog.String("path", wavPath))
+		return
+	}
+	fmt.Println("Generated", len(fingerprints), "fingerprints for the clip")
+
+	match, err := findBestMatch(fingerprints)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to match clip", slog.Any("error", err), slog.String("path", wavPath))
+		return
+	}
+	if match == nil {
+		fmt.Println("No match found")
+		return
 	}
 
-	if strings.Contains(url, "track") {
-		spotify.DownloadSingleTrack(url, SONGS_DIR)
+	songID, err := uuid.Parse(match.SongID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Matched song has an invalid ID", slog.Any("error", err), slog.String("song_id", match.SongID))
+		return
+	}
+	song, err := db.GetSongByID(songID)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to load matched song", slog.Any("error", err), slog.String("song_id", match.SongID))
+		return
 	}
+	fmt.Printf("Match: %s - %s (album: %s)\n", song.Artist, song.Title, song.Album)
+	fmt.Printf("Confidence: %.2f%% (%d aligned hashes)\n", match.Score*100, match.AlignedHashes)
+	fmt.Printf("Clip starts at %.2f seconds into the song\n", match.Offset)
 }
 
-func Search(wavPath string) {
+// audioExtensions are the files picked up when saving a whole directory.
+var audioExtensions = map[string]bool{
+	".aac": true, ".aif": true, ".aiff": true, ".flac": true, ".m4a": true,
+	".mp3": true, ".ogg": true, ".opus": true, ".wav": true, ".wma": true,
+}
+
+// Save fingerprints a local audio file, or every audio file under a
+// directory, and adds them to the library. Songs whose key is already in the
+// library are skipped.
+func Save(path string) {
+	logger := utils.GetLogger()
+	ctx := context.Background()
+
+	files, err := collectAudioFiles(path)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to read input path", slog.Any("error", err), slog.String("path", path))
+		os.Exit(1)
+	}
+	if len(files) == 0 {
+		fmt.Println("No audio files found in", path)
+		return
+	}
+
+	jobs := make(chan string)
+	var saved, skipped, failed atomic.Int32
+	// Song keys taken by a worker, so two files with the same tags are not
+	// both saved while neither is in the database yet.
+	var claimed sync.Map
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for file := range jobs {
+				wasSaved, err := saveLocalFile(file, &claimed)
+				switch {
+				case err != nil:
+					logger.ErrorContext(ctx, "Failed to save song", slog.Any("error", err), slog.String("path", file))
+					failed.Add(1)
+				case wasSaved:
+					saved.Add(1)
+				default:
+					skipped.Add(1)
+				}
+			}
+		}()
+	}
+	for _, file := range files {
+		jobs <- file
+	}
+	close(jobs)
+	wg.Wait()
+
+	fmt.Printf("Saved %d, skipped %d, failed %d of %d files\n", saved.Load(), skipped.Load(), failed.Load(), len(files))
+}
+
+// collectAudioFiles returns path itself for a file, or every file with a known
+// audio extension below path for a directory.
+func collectAudioFiles(path string) ([]string, error) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, err
+	}
+	if !info.IsDir() {
+		return []string{path}, nil
+	}
+
+	var files []string
+	err = filepath.WalkDir(path, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() && audioExtensions[strings.ToLower(filepath.Ext(file))] {
+			files = append(files, file)
+		}
+		return nil
+	})
+	return files, err
+}
+
+// saveLocalFile adds one file to the library. It reports false when a song
+// with the same key already exists or was claimed by another file of this run.
+func saveLocalFile(file string, claimed *sync.Map) (bool, error) {
+	info := songservice.InfoFromFile(file)
+	songKey := utils.GenerateSongKey(info.Artist, info.Title)
+	if _, taken := claimed.LoadOrStore(songKey, file); taken {
+		fmt.Printf("Skipping %s - %s, saved from another file\n", info.Artist, info.Title)
+		return false, nil
+	}
+	existing, err := db.FindSongs("song_key", songKey)
+	if err != nil {
+		return false, err
+	}
+	if len(existing) > 0 {
+		fmt.Printf("Skipping %s - %s, already in the library\n", info.Artist, info.Title)
+		return false, nil
+	}
+
+	if _, err := songservice.SaveSong(file, info, songservice.FingerprintConfigFromEnv()); err != nil {
+		return false, err
+	}
+	fmt.Printf("Saved %s - %s\n", info.Artist, info.Title)
+	return true, nil
+}
 
+// Reindex regenerates the fingerprints of every song stored with an older
+// hash layout or another spectrogram config, which no search can match any
+// more. Songs downloaded from YouTube are streamed again; songs saved from
+// local files are listed so they can be erased and saved again.
+func Reindex() {
+	logger := utils.GetLogger()
+	ctx := context.Background()
+
+	configKey := recognisingalgorithm.DefaultSpectrogramConfig().Key()
+	songs, err := db.FindStaleSongs(configKey, recognisingalgorithm.HashVersion)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to find songs to reindex", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if len(songs) == 0 {
+		fmt.Printf("Every song already uses hash version %d and spectrogram config %s\n", recognisingalgorithm.HashVersion, configKey)
+		return
+	}
+
+	jobs := make(chan *models.Song)
+	var reindexed, skipped, failed atomic.Int32
+	var wg sync.WaitGroup
+	for i := 0; i < runtime.NumCPU(); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for song := range jobs {
+				err := spotify.ReindexSong(song)
+				switch {
+				case errors.Is(err, spotify.ErrNoYoutubeID):
+					fmt.Printf("Cannot reindex %s - %s, it was saved from a local file; erase it with -id %s and save it again\n", song.Artist, song.Title, song.ID)
+					skipped.Add(1)
+				case err != nil:
+					logger.ErrorContext(ctx, "Failed to reindex song", slog.Any("error", err), slog.String("song_id", song.ID.String()))
+					failed.Add(1)
+				default:
+					fmt.Printf("Reindexed %s - %s\n", song.Artist, song.Title)
+					reindexed.Add(1)
+				}
+			}
+		}()
+	}
+	for i := range songs {
+		jobs <- &songs[i]
+	}
+	close(jobs)
+	wg.Wait()
+
+	fmt.Printf("Reindexed %d, skipped %d, failed %d of %d songs\n", reindexed.Load(), skipped.Load(), failed.Load(), len(songs))
+}
+
+// Erase deletes songs, their fingerprints and any of their files left in
+// SONGS_DIR or TEMP_DIR. Exactly one of -id, -key, -artist or -all selects
+// what to delete; -all also needs -yes.
+func Erase(args []string) {
+	logger := utils.GetLogger()
+	ctx := context.Background()
+
+	flags := flag.NewFlagSet("erase", flag.ExitOnError)
+	id := flags.String("id", "", "delete the song with this ID")
+	key := flags.String("key", "", "delete the song with this song key (\"Artist-Title\")")
+	artist := flags.String("artist", "", "delete every song by this artist")
+	all := flags.Bool("all", false, "delete the whole library")
+	yes := flags.Bool("yes", false, "confirm deleting the whole library")
+	flags.Parse(args)
+
+	selectors := 0
+	for _, set := range []bool{*id != "", *key != "", *artist != "", *all} {
+		if set {
+			selectors++
+		}
+	}
+	if selectors != 1 {
+		fmt.Println("Expected exactly one of -id, -key, -artist or -all.")
+		fmt.Println("Example: go run main.go erase -artist \"Daft Punk\"")
+		os.Exit(1)
+	}
+
+	if *all {
+		if !*yes {
+			fmt.Println("Refusing to delete the whole library without -yes.")
+			os.Exit(1)
+		}
+		count, err := db.DeleteAllSongs()
+		if err != nil {
+			logger.ErrorContext(ctx, "Failed to delete songs", slog.Any("error", err))
+			os.Exit(1)
+		}
+		for _, dir := range []string{SONGS_DIR, TEMP_DIR} {
+			if err := clearDir(dir); err != nil {
+				logger.WarnContext(ctx, "Failed to clear directory", slog.Any("error", err), slog.String("dir", dir))
+			}
+		}
+		fmt.Println("Deleted", count, "songs")
+		return
+	}
+
+	var songs []models.Song
+	var err error
+	switch {
+	case *id != "":
+		var songID uuid.UUID
+		songID, err = uuid.Parse(*id)
+		if err != nil {
+			fmt.Println("Invalid song ID:", *id)
+			os.Exit(1)
+		}
+		var song *models.Song
+		song, err = db.GetSongByID(songID)
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			err = nil
+		} else if song != nil {
+			songs = []models.Song{*song}
+		}
+	case *key != "":
+		songs, err = db.FindSongs("song_key", *key)
+	case *artist != "":
+		songs, err = db.FindSongs("artist", *artist)
+	}
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to find songs", slog.Any("error", err))
+		os.Exit(1)
+	}
+	if len(songs) == 0 {
+		fmt.Println("No matching songs found")
+		return
+	}
+
+	ids := make([]uuid.UUID, len(songs))
+	for i, song := range songs {
+		ids[i] = song.ID
+	}
+	count, err := db.DeleteSongs(ids)
+	if err != nil {
+		logger.ErrorContext(ctx, "Failed to delete songs", slog.Any("error", err))
+		os.Exit(1)
+	}
+	for _, song := range songs {
+		fmt.Printf("Deleted %s - %s (%s)\n", song.Artist, song.Title, song.ID)
+		if err := removeSongFiles(song); err != nil {
+			logger.WarnContext(ctx, "Failed to remove song files", slog.Any("error", err), slog.String("song_id", song.ID.String()))
+		}
+	}
+	fmt.Println("Deleted", count, "songs")
+}
+
+// removeSongFiles removes downloads and conversions of a song, which are named
+// "<artist> - <title>" with any extension, optionally with a "tmp_" prefix.
+func removeSongFiles(song models.Song) error {
+	name := fmt.Sprintf("%s - %s", song.Artist, song.Title)
+	for _, dir := range []string{SONGS_DIR, TEMP_DIR} {
+		entries, err := os.ReadDir(dir)
+		if os.IsNotExist(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		for _, entry := range entries {
+			base := strings.TrimPrefix(entry.Name(), "tmp_")
+			if entry.IsDir() || strings.TrimSuffix(base, filepath.Ext(base)) != name {
+				continue
+			}
+			if err := os.Remove(filepath.Join(dir, entry.Name())); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// clearDir removes everything inside dir but keeps dir itself.
+func clearDir(dir string) error {
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if err := os.RemoveAll(filepath.Join(dir, entry.Name())); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// fingerprintClip runs a clip through the same pipeline used when ingesting
+// songs.
+func fingerprintClip(clipPath string) ([]pkg.Fingerprint, error) {
+	var fingerprints []pkg.Fingerprint
+	_, err := songservice.FingerprintAudio(clipPath, "", songservice.FingerprintConfigFromEnv(), func(fp pkg.Fingerprint) error {
+		fingerprints = append(fingerprints, fp)
+		return nil
+	})
+	return fingerprints, err
+}
+
+// findBestMatch returns the top ranked song for a clip, or nil when no song
+// aligns with it.
+func findBestMatch(fingerprints []pkg.Fingerprint) (*recognisingalgorithm.Candidate, error) {
+	candidates, err := findMatches(fingerprints)
+	if err != nil || len(candidates) == 0 {
+		return nil, err
+	}
+	return &candidates[0], nil
+}
+
+// findMatches looks the clip's hashes up in the database and ranks the songs
+// they belong to.
+func findMatches(fingerprints []pkg.Fingerprint) ([]recognisingalgorithm.Candidate, error) {
+	if len(fingerprints) == 0 {
+		return nil, errors.New("clip produced no fingerprints")
+	}
+	stored, err := lookupFingerprints(uniqueHashes(fingerprints), recognisingalgorithm.DefaultSpectrogramConfig())
+	if err != nil {
+		return nil, err
+	}
+	return recognisingalgorithm.Match(fingerprints, stored), nil
+}
+
+// uniqueHashes returns each distinct hash once, in the form stored in the DB.
+func uniqueHashes(fingerprints []pkg.Fingerprint) []int64 {
+	seen := map[uint32]struct{}{}
+	hashes := make([]int64, 0, len(fingerprints))
+	for _, fp := range fingerprints {
+		if _, ok := seen[fp.Hash]; ok {
+			continue
+		}
+		seen[fp.Hash] = struct{}{}
+		hashes = append(hashes, int64(fp.Hash))
+	}
+	return hashes
+}
+
+// lookupFingerprints loads the stored rows for the given hashes that were
+// computed with the same spectrogram config and hash layout as the query.
+func lookupFingerprints(hashes []int64, config recognisingalgorithm.SpectrogramConfig) ([]pkg.Fingerprint, error) {
+	rows, err := db.GetFingerprintsByHashes(hashes, config.Key(), recognisingalgorithm.HashVersion)
+	if err != nil {
+		return nil, err
+	}
+	stored := make([]pkg.Fingerprint, len(rows))
+	for i, row := range rows {
+		stored[i] = pkg.Fingerprint{
+			Hash: uint32(row.Hash),
+			Couple: pkg.Couple{
+				SongID:     row.SongID.String(),
+				AnchorTime: uint32(math.Round(row.AnchorTime * 1000)),
+			},
+		}
+	}
+	return stored, nil
 }
@@ -0,0 +1,285 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/Pritam-deb/echo-sense/db"
+	"github.com/Pritam-deb/echo-sense/db/models"
+	recognisingalgorithm "github.com/Pritam-deb/echo-sense/internals/recognisingAlgorithm"
+	wavservice "github.com/Pritam-deb/echo-sense/internals/wavService"
+	"github.com/Pritam-deb/echo-sense/pkg"
+	"github.com/Pritam-deb/echo-sense/utils"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+)
+
+const (
+	maxUploadBytes   = 50 << 20 // Largest clip accepted by /recognize
+	maxReturnedMatch = 5        // Number of ranked candidates returned by /recognize
+)
+
+type matchResponse struct {
+	Song          models.Song `json:"song"`
+	Offset        float64     `json:"offset"`
+	AlignedHashes int         `json:"aligned_hashes"`
+	Score         float64     `json:"score"`
+}
+
+type recognizeResponse struct {
+	Matches []matchResponse `json:"matches"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// Serve starts the HTTP recognition API on addr and blocks until the server
+// stops.
+func Serve(addr string) {
+	logger := utils.GetLogger()
+	ctx := context.Background()
+
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           NewRouter(),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+	logger.InfoContext(ctx, "Starting HTTP server", slog.String("addr", addr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		logger.ErrorContext(ctx, "HTTP server stopped", slog.Any("error", err))
+		os.Exit(1)
+	}
+}
+
+// NewRouter returns the handler serving every API endpoint.
+func NewRouter() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /recognize", recognizeHandler)
+	mux.HandleFunc("GET /songs", listSongsHandler)
+	mux.HandleFunc("GET /songs/{id}", getSongHandler)
+	mux.HandleFunc("DELETE /songs/{id}", deleteSongHandler)
+	mux.HandleFunc("GET /ws/recognize", streamRecognizeHandler)
+	return mux
+}
+
+// recognizeHandler accepts either a multipart upload in the "file" field or
+// a JSON body shaped like pkg.RecordData and returns the ranked matches.
+func recognizeHandler(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger()
+	r.Body = http.MaxBytesReader(w, r.Body, maxUploadBytes)
+
+	var (
+		clipPath string
+		err      error
+	)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "multipart/form-data":
+		clipPath, err = saveUploadedClip(r)
+	case "application/json":
+		clipPath, err = saveRecordedClip(r.Body)
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, "expected multipart/form-data or application/json")
+		return
+	}
+	if clipPath != "" {
+		defer os.Remove(clipPath)
+	}
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	fingerprints, err := fingerprintClip(clipPath)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to fingerprint clip", slog.Any("error", err))
+		writeError(w, http.StatusUnprocessableEntity, "could not process audio")
+		return
+	}
+	candidates, err := findMatches(fingerprints)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to match clip", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "could not match audio")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, recognizeResponse{Matches: buildMatches(r.Context(), candidates, maxReturnedMatch)})
+}
+
+// buildMatches loads the songs behind the top ranked candidates.
+func buildMatches(ctx context.Context, candidates []recognisingalgorithm.Candidate, limit int) []matchResponse {
+	logger := utils.GetLogger()
+	matches := []matchResponse{}
+	for _, candidate := range candidates {
+		if len(matches) == limit {
+			break
+		}
+		songID, err := uuid.Parse(candidate.SongID)
+		if err != nil {
+			continue
+		}
+		song, err := db.GetSongByID(songID)
+		if err != nil {
+			logger.WarnContext(ctx, "Matched song could not be loaded", slog.Any("error", err), slog.String("song_id", candidate.SongID))
+			continue
+		}
+		matches = append(matches, matchResponse{
+			Song:          *song,
+			Offset:        candidate.Offset,
+			AlignedHashes: candidate.AlignedHashes,
+			Score:         candidate.Score,
+		})
+	}
+	return matches
+}
+
+// saveUploadedClip stores the "file" field of a multipart request in TEMP_DIR.
+func saveUploadedClip(r *http.Request) (string, error) {
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		return "", fmt.Errorf("missing audio file: %w", err)
+	}
+	defer file.Close()
+
+	if err := utils.CreateDirIfNotExist(TEMP_DIR); err != nil {
+		return "", err
+	}
+	clipPath := filepath.Join(TEMP_DIR, uuid.NewString()+filepath.Ext(header.Filename))
+	out, err := os.Create(clipPath)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, file); err != nil {
+		out.Close()
+		os.Remove(clipPath)
+		return "", err
+	}
+	return clipPath, out.Close()
+}
+
+// saveRecordedClip decodes a pkg.RecordData payload into a WAV file in
+// TEMP_DIR. The audio is either a complete WAV file or raw little-endian PCM
+// described by the channel, sample rate and sample size fields.
+func saveRecordedClip(body io.Reader) (string, error) {
+	var record pkg.RecordData
+	if err := json.NewDecoder(body).Decode(&record); err != nil {
+		return "", fmt.Errorf("invalid JSON body: %w", err)
+	}
+	audio, err := base64.StdEncoding.DecodeString(record.Audio)
+	if err != nil {
+		return "", fmt.Errorf("audio is not valid base64: %w", err)
+	}
+	if len(audio) == 0 {
+		return "", errors.New("audio is empty")
+	}
+
+	if err := utils.CreateDirIfNotExist(TEMP_DIR); err != nil {
+		return "", err
+	}
+	clipPath := filepath.Join(TEMP_DIR, uuid.NewString()+".wav")
+	if bytes.HasPrefix(audio, []byte("RIFF")) {
+		return clipPath, os.WriteFile(clipPath, audio, 0600)
+	}
+	if record.Channels < 1 || record.SampleRate < 1 || record.SampleSize < 8 || record.SampleSize%8 != 0 {
+		return "", errors.New("raw PCM audio needs channels, sample_rate and sample_size")
+	}
+	return clipPath, wavservice.WriteWavFile(clipPath, audio, record.SampleRate, record.Channels, record.SampleSize)
+}
+
+func listSongsHandler(w http.ResponseWriter, r *http.Request) {
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	offset, err := queryInt(r, "offset")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	songs, err := db.ListSongs(limit, offset)
+	if err != nil {
+		utils.GetLogger().ErrorContext(r.Context(), "Failed to list songs", slog.Any("error", err))
+		writeError(w, http.StatusInternalServerError, "could not list songs")
+		return
+	}
+	if songs == nil {
+		songs = []models.Song{}
+	}
+	writeJSON(w, http.StatusOK, songs)
+}
+
+func getSongHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid song id")
+		return
+	}
+	song, err := db.GetSongByID(id)
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		writeError(w, http.StatusNotFound, "song not found")
+		return
+	}
+	if err != nil {
+		utils.GetLogger().ErrorContext(r.Context(), "Failed to load song", slog.Any("error", err), slog.String("song_id", id.String()))
+		writeError(w, http.StatusInternalServerError, "could not load song")
+		return
+	}
+	writeJSON(w, http.StatusOK, song)
+}
+
+func deleteSongHandler(w http.ResponseWriter, r *http.Request) {
+	id, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid song id")
+		return
+	}
+	deleted, err := db.DeleteSong(id)
+	if err != nil {
+		utils.GetLogger().ErrorContext(r.Context(), "Failed to delete song", slog.Any("error", err), slog.String("song_id", id.String()))
+		writeError(w, http.StatusInternalServerError, "could not delete song")
+		return
+	}
+	if !deleted {
+		writeError(w, http.StatusNotFound, "song not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func queryInt(r *http.Request, key string) (int, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("%s must be a non-negative integer", key)
+	}
+	return n, nil
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		utils.GetLogger().Error("Failed to write JSON response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
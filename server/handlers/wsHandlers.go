@@ -0,0 +1,204 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+
+	recognisingalgorithm "github.com/Pritam-deb/echo-sense/internals/recognisingAlgorithm"
+	songservice "github.com/Pritam-deb/echo-sense/internals/songService"
+	wavservice "github.com/Pritam-deb/echo-sense/internals/wavService"
+	"github.com/Pritam-deb/echo-sense/pkg"
+	"github.com/Pritam-deb/echo-sense/utils"
+	"github.com/gorilla/websocket"
+)
+
+const (
+	streamStepSeconds     = 1.0     // New audio gathered between two recognition passes
+	streamMaxSeconds      = 30.0    // Stream length after which a final answer is forced
+	streamFinalHashes     = 25      // Aligned hashes needed before answering early
+	streamFinalScore      = 0.05    // Score needed before answering early
+	maxStreamMessageBytes = 4 << 20 // Largest RecordData chunk accepted
+)
+
+var upgrader = websocket.Upgrader{
+	// Web and mobile clients connect from their own origins.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+type streamResponse struct {
+	Type     string          `json:"type"` // "interim", "final" or "error"
+	Matches  []matchResponse `json:"matches,omitempty"`
+	Duration float64         `json:"duration"` // Seconds of audio received so far
+	Error    string          `json:"error,omitempty"`
+}
+
+// streamRecognizeHandler recognises live microphone audio. The client sends
+// successive pkg.RecordData chunks of raw 16-bit PCM; a chunk with empty audio
+// marks the end of the recording. After every pass over new audio the server
+// replies with interim matches, and sends a final result as soon as the best
+// match is confident enough, the stream gets too long, or the client ends it.
+func streamRecognizeHandler(w http.ResponseWriter, r *http.Request) {
+	logger := utils.GetLogger()
+	conn, err := upgrader.Upgrade(w, r, nil)
+	if err != nil {
+		logger.ErrorContext(r.Context(), "Failed to upgrade to WebSocket", slog.Any("error", err))
+		return
+	}
+	defer conn.Close()
+	conn.SetReadLimit(maxStreamMessageBytes)
+
+	session := newStreamSession()
+	for {
+		_, message, err := conn.ReadMessage()
+		if err != nil {
+			if !websocket.IsCloseError(err, websocket.CloseNormalClosure, websocket.CloseGoingAway) {
+				logger.WarnContext(r.Context(), "WebSocket read failed", slog.Any("error", err))
+			}
+			return
+		}
+
+		var record pkg.RecordData
+		if err := json.Unmarshal(message, &record); err != nil {
+			conn.WriteJSON(streamResponse{Type: "error", Error: "invalid JSON chunk", Duration: session.duration()})
+			continue
+		}
+		final := record.Audio == ""
+		if !final {
+			if err := session.addChunk(record); err != nil {
+				conn.WriteJSON(streamResponse{Type: "error", Error: err.Error(), Duration: session.duration()})
+				continue
+			}
+			if session.duration() >= streamMaxSeconds {
+				final = true
+			} else if !session.ready() {
+				continue
+			}
+		}
+
+		if err := session.analyse(final); err != nil {
+			logger.ErrorContext(r.Context(), "Failed to analyse stream", slog.Any("error", err))
+			conn.WriteJSON(streamResponse{Type: "error", Error: "could not match audio", Duration: session.duration()})
+			return
+		}
+		candidates := session.matcher.Candidates()
+		if len(candidates) > 0 && candidates[0].AlignedHashes >= streamFinalHashes && candidates[0].Score >= streamFinalScore {
+			final = true
+		}
+
+		response := streamResponse{
+			Type:     "interim",
+			Matches:  buildMatches(r.Context(), candidates, maxReturnedMatch),
+			Duration: session.duration(),
+		}
+		if final {
+			response.Type = "final"
+		}
+		if err := conn.WriteJSON(response); err != nil {
+			logger.WarnContext(r.Context(), "WebSocket write failed", slog.Any("error", err))
+			return
+		}
+		if final {
+			conn.WriteMessage(websocket.CloseMessage, websocket.FormatCloseMessage(websocket.CloseNormalClosure, ""))
+			return
+		}
+	}
+}
+
+// streamSession feeds audio from one WebSocket client through a
+// recognisingalgorithm.StreamFingerprinter and matches it pass by pass. The
+// fingerprinter only emits a fingerprint once its target zone is complete,
+// so each pass looks up exactly the fingerprints produced since the last one
+// and every hash votes once.
+type streamSession struct {
+	sampleRate    int // Set by the first chunk; the fingerprinter resamples it
+	fingerprinter *recognisingalgorithm.StreamFingerprinter
+	pending       []pkg.Fingerprint // Emitted since the last pass
+	analysedAt    float64           // duration() at the last pass
+	config        recognisingalgorithm.FingerprintConfig
+	downmix       wavservice.Downmix
+	matcher       *recognisingalgorithm.Matcher
+}
+
+func newStreamSession() *streamSession {
+	return &streamSession{
+		config:  songservice.FingerprintConfigFromEnv(),
+		downmix: songservice.DownmixFromEnv(),
+		matcher: recognisingalgorithm.NewMatcher(),
+	}
+}
+
+func (s *streamSession) duration() float64 {
+	if s.fingerprinter == nil {
+		return 0
+	}
+	return s.fingerprinter.Duration()
+}
+
+func (s *streamSession) ready() bool {
+	return s.duration()-s.analysedAt >= streamStepSeconds
+}
+
+// addChunk decodes one chunk, mixes it down to mono with the configured
+// downmix and writes it to the fingerprinter. Every chunk of a stream must
+// use the same sample rate.
+func (s *streamSession) addChunk(record pkg.RecordData) error {
+	if record.SampleSize != 16 {
+		return fmt.Errorf("unsupported sample_size %d, only 16-bit PCM is supported", record.SampleSize)
+	}
+	if record.Channels < 1 || record.SampleRate < 1 {
+		return errors.New("chunk needs channels and sample_rate")
+	}
+	if s.sampleRate != 0 && record.SampleRate != s.sampleRate {
+		return fmt.Errorf("sample_rate changed from %d to %d mid-stream", s.sampleRate, record.SampleRate)
+	}
+	audio, err := base64.StdEncoding.DecodeString(record.Audio)
+	if err != nil {
+		return fmt.Errorf("audio is not valid base64: %w", err)
+	}
+	mono, err := wavservice.ConvertWavDataToSamples(audio, record.Channels, s.downmix)
+	if err != nil {
+		return err
+	}
+
+	if s.fingerprinter == nil {
+		s.fingerprinter, err = recognisingalgorithm.NewStreamFingerprinter(record.SampleRate, s.config, "", func(fp pkg.Fingerprint) error {
+			s.pending = append(s.pending, fp)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+		s.sampleRate = record.SampleRate
+	}
+	return s.fingerprinter.Write(mono)
+}
+
+// analyse matches the fingerprints emitted since the last pass. On the final
+// pass the fingerprinter is flushed so the tail of the stream is used too.
+func (s *streamSession) analyse(final bool) error {
+	s.analysedAt = s.duration()
+	if s.fingerprinter == nil {
+		return nil
+	}
+	if final {
+		if err := s.fingerprinter.Flush(); err != nil {
+			return err
+		}
+	}
+	fresh := s.pending
+	s.pending = nil
+	if len(fresh) == 0 {
+		return nil
+	}
+
+	stored, err := lookupFingerprints(uniqueHashes(fresh), s.config.Spectrogram)
+	if err != nil {
+		return err
+	}
+	s.matcher.Add(fresh, stored)
+	return nil
+}
@@ -1,7 +1,10 @@
 package recognisingalgorithm
 
 import (
-	"math/cmplx"
+	"cmp"
+	"fmt"
+	"math"
+	"slices"
 
 	"github.com/Pritam-deb/echo-sense/pkg"
 )
@@ -14,147 +17,227 @@ type Peak struct {
 	Bin  int        // Frequency bin index
 }
 
+// FingerprintConfig gathers the settings of every stage of the
+// fingerprinting pipeline.
+type FingerprintConfig struct {
+	Spectrogram SpectrogramConfig
+	Peaks       PeakPickerConfig
+	TargetZone  TargetZone
+}
+
+// DefaultFingerprintConfig returns the config songs are ingested and searched
+// with. Clips only match songs fingerprinted with the same spectrogram config,
+// so changing that part means reindexing the library; peak picking and the
+// target zone may differ between songs and clips.
+func DefaultFingerprintConfig() FingerprintConfig {
+	return FingerprintConfig{
+		Spectrogram: DefaultSpectrogramConfig(),
+		Peaks:       DefaultPeakPickerConfig(),
+		TargetZone:  DefaultTargetZone(),
+	}
+}
+
+// Validate reports whether every stage of the config is usable.
+func (c FingerprintConfig) Validate() error {
+	if err := c.Spectrogram.Validate(); err != nil {
+		return err
+	}
+	if err := c.Peaks.Validate(); err != nil {
+		return err
+	}
+	return c.TargetZone.Validate()
+}
+
 // BuildConstellationMap processes the spectrogram to extract a constellation map,
 // which is a set of significant peaks representing local maxima in time-frequency space.
 // This map is used as the basis for generating fingerprints.
-func BuildConstellationMap(spectrogram [][]complex128, audioDuration float64) []Peak {
-	return ExtractPeaks(spectrogram, audioDuration)
-}
-
-// ExtractPeaks analyzes a spectrogram and extracts significant local maxima peaks in each frequency band over time.
-// It collects the top N peaks per band per time bin, using local maxima detection and adaptive thresholding.
-func ExtractPeaks(spectrogram [][]complex128, audioDuration float64) []Peak {
-	if len(spectrogram) < 1 {
-		return []Peak{}
-	}
-
-	// Define frequency bands as (min, max) bin indices (exclusive).
-	bands := []struct{ min, max int }{
-		{0, 10}, {10, 20}, {20, 40}, {40, 80}, {80, 160}, {160, 512},
-	}
-	topN := 3 // Number of top peaks to collect per band per time bin.
-
-	var peaks []Peak
-	binDuration := audioDuration / float64(len(spectrogram))
-
-	// Helper: find local maxima in a slice of magnitudes.
-	findLocalMaxima := func(mags []float64, window int) []int {
-		var idxs []int
-		for i := window; i < len(mags)-window; i++ {
-			isMax := true
-			for j := i - window; j <= i+window; j++ {
-				if j == i {
-					continue
-				}
-				if mags[j] >= mags[i] {
-					isMax = false
-					break
-				}
-			}
-			if isMax {
-				idxs = append(idxs, i)
-			}
-		}
-		return idxs
-	}
-
-	for binIdx, bin := range spectrogram {
-		for _, band := range bands {
-			// Compute magnitudes for this band.
-			bandSize := band.max - band.min
-			if band.max > len(bin) {
-				continue
-			}
-			mags := make([]float64, bandSize)
-			for i := 0; i < bandSize; i++ {
-				mags[i] = cmplx.Abs(bin[band.min+i])
-			}
-			// Find local maxima in this band.
-			localMaxIdxs := findLocalMaxima(mags, 1)
-			// Collect (idx, mag) pairs for sorting.
-			type idxMag struct {
-				idx int
-				mag float64
-			}
-			var maxima []idxMag
-			for _, idx := range localMaxIdxs {
-				maxima = append(maxima, idxMag{idx: idx, mag: mags[idx]})
-			}
-			// Sort by descending magnitude.
-			for i := 0; i < len(maxima); i++ {
-				for j := i + 1; j < len(maxima); j++ {
-					if maxima[j].mag > maxima[i].mag {
-						maxima[i], maxima[j] = maxima[j], maxima[i]
-					}
-				}
-			}
-			// Adaptive threshold: use mean + stddev of band.
-			var sum, sumSq float64
-			for _, v := range mags {
-				sum += v
-				sumSq += v * v
-			}
-			mean := sum / float64(len(mags))
-			std := 0.0
-			if len(mags) > 1 {
-				std = (sumSq/float64(len(mags)) - mean*mean)
-				if std > 0 {
-					std = sqrt(std)
-				} else {
-					std = 0
-				}
-			}
-			threshold := mean + std*0.5
-			// Take up to topN maxima above threshold.
-			count := 0
-			for _, m := range maxima {
-				if m.mag < threshold {
-					break
-				}
-				freqIdx := band.min + m.idx
-				// Calculate the time for this peak.
-				peakTime := float64(binIdx) * binDuration
-				peaks = append(peaks, Peak{
-					Time: peakTime,
-					Freq: bin[freqIdx],
-					Mag:  m.mag,
-					Bin:  freqIdx,
-				})
-				count++
-				if count >= topN {
-					break
-				}
-			}
-		}
-	}
-
-	return peaks
+func BuildConstellationMap(spectrogram [][]complex128, config FingerprintConfig) ([]Peak, error) {
+	return ExtractPeaks(spectrogram, config)
 }
 
+// HashVersion identifies the layout of the hashes Fingerprint produces and is
+// stored with every song, so fingerprints from an older layout are never
+// matched against current ones. Version 1 truncated the time delta to whole
+// seconds before scaling it to milliseconds; version 2 paired each anchor
+// with the next peaks in extraction order, mostly from its own frame, rather
+// than with a TargetZone.
+const HashVersion = 3
+
 const (
-	maxFreqBits    = 9  // Number of bits for quantized frequency bins
-	maxDeltaBits   = 14 // Number of bits for time delta
-	targetZoneSize = 5  // Number of target peaks per anchor
-	freqQuant      = 2  // Quantization step for frequency bins (robustness)
+	maxFreqBits  = 9  // Number of bits for quantized frequency bins
+	maxDeltaBits = 14 // Number of bits for time delta
+	freqQuant    = 2  // Quantization step for frequency bins (robustness)
 )
 
+// TargetZone is the region after an anchor peak whose peaks are paired with
+// it. Targets must lie between MinTimeOffset and MaxTimeOffset seconds after
+// the anchor and within FreqSpan Hz of it; the earliest Targets of them are
+// used.
+type TargetZone struct {
+	MinTimeOffset float64 // Seconds; above zero so peaks of the anchor's own frame are skipped
+	MaxTimeOffset float64 // Seconds; a hash holds deltas of up to 16.383 s. Streams hold back this much audio
+	FreqSpan      float64 // Hz above or below the anchor
+	Targets       int     // Peaks paired with each anchor
+}
+
+// DefaultTargetZone pairs each anchor with the first five peaks 10 to 500 ms
+// after it and within 1 kHz of it.
+func DefaultTargetZone() TargetZone {
+	return TargetZone{
+		MinTimeOffset: 0.01,
+		MaxTimeOffset: 0.5,
+		FreqSpan:      1000,
+		Targets:       5,
+	}
+}
+
+// Validate reports whether the zone can be used to pair peaks.
+func (z TargetZone) Validate() error {
+	if !(z.MinTimeOffset > 0) || !(z.MaxTimeOffset >= z.MinTimeOffset) {
+		return fmt.Errorf("target zone needs 0 < MinTimeOffset <= MaxTimeOffset, got %v and %v", z.MinTimeOffset, z.MaxTimeOffset)
+	}
+	if z.MaxTimeOffset*1000 > 1<<maxDeltaBits-1 {
+		return fmt.Errorf("target zone ends %v s after the anchor, but hashes hold at most %v ms", z.MaxTimeOffset, 1<<maxDeltaBits-1)
+	}
+	if !(z.FreqSpan > 0) {
+		return fmt.Errorf("target zone frequency span must be positive, got %v", z.FreqSpan)
+	}
+	if z.Targets < 1 {
+		return fmt.Errorf("target zone needs at least one target, got %d", z.Targets)
+	}
+	return nil
+}
+
 // Fingerprint generates robust hashes from the extracted peaks.
 // It uses quantized frequency bins and time deltas to create addresses for matching.
-func Fingerprint(peaks []Peak, songID string) map[uint32]pkg.Couple {
-	fingerprints := map[uint32]pkg.Couple{}
-
-	for i, anchor := range peaks {
-		for j := i + 1; j < len(peaks) && j <= i+targetZoneSize; j++ {
-			target := peaks[j]
-			// Quantize frequency bins for robustness.
-			anchorFreqQ := quantizeFreqBin(anchor.Bin, freqQuant)
-			targetFreqQ := quantizeFreqBin(target.Bin, freqQuant)
-			address := createAddressQuant(anchorFreqQ, targetFreqQ, anchor.Time, target.Time)
-			anchorTimeMs := uint32(anchor.Time * 1000)
-			fingerprints[address] = pkg.Couple{SongID: songID, AnchorTime: anchorTimeMs}
+// Peaks may be given in any order; they are paired in the order of sortPeaks.
+// Every (hash, anchor time) pair is kept, so a hash that repeats within a song
+// contributes all of its anchors; only exact duplicates are dropped.
+func Fingerprint(peaks []Peak, songID string, config FingerprintConfig) ([]pkg.Fingerprint, error) {
+	var fingerprints []pkg.Fingerprint
+	stream, err := newFingerprintStream(songID, config, func(fp pkg.Fingerprint) error {
+		fingerprints = append(fingerprints, fp)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sorted := slices.Clone(peaks)
+	sortPeaks(sorted)
+	stream.add(sorted)
+	stream.flush()
+	return fingerprints, nil
+}
+
+// sortPeaks orders peaks by time and, within a frame, by frequency, which
+// decides the targets chosen among peaks of the same frame.
+func sortPeaks(peaks []Peak) {
+	slices.SortFunc(peaks, func(a, b Peak) int {
+		return cmp.Or(cmp.Compare(a.Time, b.Time), cmp.Compare(a.Bin, b.Bin))
+	})
+}
+
+// fingerprintStream pairs peaks into fingerprints as they arrive in the order
+// of sortPeaks. An anchor is paired once a peak past the end of its target zone has
+// arrived, so only MaxTimeOffset seconds of peaks are ever held back.
+type fingerprintStream struct {
+	songID   string
+	zone     TargetZone
+	freqSpan int // zone.FreqSpan in bins
+	emit     func(pkg.Fingerprint) error
+	pending  []Peak              // Peaks not yet used as an anchor
+	anchorMs uint32              // Anchor time of the hashes in seen
+	seen     map[uint32]struct{} // Hashes already emitted at anchorMs
+}
+
+func newFingerprintStream(songID string, config FingerprintConfig, emit func(pkg.Fingerprint) error) (*fingerprintStream, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &fingerprintStream{
+		songID:   songID,
+		zone:     config.TargetZone,
+		freqSpan: config.Spectrogram.hzToBin(config.TargetZone.FreqSpan),
+		emit:     emit,
+		seen:     map[uint32]struct{}{},
+	}, nil
+}
+
+// add queues peaks, which must be sorted and not earlier than those already
+// added, and emits the fingerprints of every anchor whose target zone is now
+// complete.
+func (f *fingerprintStream) add(peaks []Peak) error {
+	f.pending = append(f.pending, peaks...)
+	if len(f.pending) == 0 {
+		return nil
+	}
+	latest := f.pending[len(f.pending)-1].Time
+	anchored := 0
+	for ; anchored < len(f.pending) && latest-f.pending[anchored].Time > f.zone.MaxTimeOffset; anchored++ {
+		if err := f.anchor(f.pending[anchored], f.pending[anchored+1:]); err != nil {
+			return err
 		}
 	}
-	return fingerprints
+	n := copy(f.pending, f.pending[anchored:])
+	f.pending = f.pending[:n]
+	return nil
+}
+
+// flush emits the fingerprints of the remaining anchors, whose target zones
+// are cut short by the end of the audio.
+func (f *fingerprintStream) flush() error {
+	for i := range f.pending {
+		if err := f.anchor(f.pending[i], f.pending[i+1:]); err != nil {
+			return err
+		}
+	}
+	f.pending = f.pending[:0]
+	return nil
+}
+
+// anchor pairs anchor with the first peaks of later, which follow it in time
+// order, that fall in its target zone.
+func (f *fingerprintStream) anchor(anchor Peak, later []Peak) error {
+	anchorTimeMs := uint32(anchor.Time * 1000)
+	if anchorTimeMs != f.anchorMs {
+		// Peaks arrive in time order, so duplicates share an anchor time.
+		clear(f.seen)
+		f.anchorMs = anchorTimeMs
+	}
+	paired := 0
+	for _, target := range later {
+		offset := target.Time - anchor.Time
+		if offset > f.zone.MaxTimeOffset || paired == f.zone.Targets {
+			break
+		}
+		if offset < f.zone.MinTimeOffset || abs(target.Bin-anchor.Bin) > f.freqSpan {
+			continue
+		}
+		paired++
+		// Quantize frequency bins for robustness.
+		anchorFreqQ := quantizeFreqBin(anchor.Bin, freqQuant)
+		targetFreqQ := quantizeFreqBin(target.Bin, freqQuant)
+		address := createAddressQuant(anchorFreqQ, targetFreqQ, anchor.Time, target.Time)
+		if _, ok := f.seen[address]; ok {
+			continue
+		}
+		f.seen[address] = struct{}{}
+		err := f.emit(pkg.Fingerprint{
+			Hash:   address,
+			Couple: pkg.Couple{SongID: f.songID, AnchorTime: anchorTimeMs},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+	return x
 }
 
 // quantizeFreqBin returns the quantized frequency bin index.
@@ -168,7 +251,7 @@ func createAddressQuant(anchorFreq, targetFreq int, anchorTime, targetTime float
 	// Clamp bins to 9 bits.
 	anchorFreq &= (1<<maxFreqBits - 1)
 	targetFreq &= (1<<maxFreqBits - 1)
-	deltaMs := uint32(targetTime-anchorTime) * 1000
+	deltaMs := uint32(math.Round((targetTime - anchorTime) * 1000))
 	if deltaMs > (1<<maxDeltaBits - 1) {
 		deltaMs = (1<<maxDeltaBits - 1)
 	}
@@ -177,16 +260,3 @@ func createAddressQuant(anchorFreq, targetFreq int, anchorTime, targetTime float
 		deltaMs
 	return address
 }
-
-// sqrt is a helper for square root of float64.
-func sqrt(x float64) float64 {
-	// Use Newton's method for sqrt.
-	z := x
-	if z == 0 {
-		return 0
-	}
-	for i := 0; i < 8; i++ {
-		z = z - (z*z-x)/(2*z)
-	}
-	return z
-}
@@ -0,0 +1,118 @@
+package recognisingalgorithm
+
+import (
+	"slices"
+	"testing"
+
+	"github.com/Pritam-deb/echo-sense/pkg"
+)
+
+// The address holds the anchor bin at bit 23, the target bin at bit 14 and
+// the time delta in milliseconds in the low 14 bits.
+func TestCreateAddressQuant(t *testing.T) {
+	tests := []struct {
+		name                   string
+		anchorFreq, targetFreq int
+		anchorTime, targetTime float64
+		want                   uint32
+	}{
+		{"10 ms apart", 100, 200, 1.0, 1.01, 100<<23 | 200<<14 | 10},
+		{"250 ms apart", 100, 200, 1.0, 1.25, 100<<23 | 200<<14 | 250},
+		{"999 ms apart", 100, 200, 1.0, 1.999, 100<<23 | 200<<14 | 999},
+		{"rounds to the nearest ms", 0, 0, 0.0101, 0.0205, 10},
+		{"delta clamps to 14 bits", 3, 5, 0, 20, 3<<23 | 5<<14 | 16383},
+		{"highest bins", 511, 511, 0, 0.1, 511<<23 | 511<<14 | 100},
+	}
+	for _, tt := range tests {
+		got := createAddressQuant(tt.anchorFreq, tt.targetFreq, tt.anchorTime, tt.targetTime)
+		if got != tt.want {
+			t.Errorf("%s: address %#x, want %#x", tt.name, got, tt.want)
+		}
+	}
+}
+
+// pairing is a fingerprint decoded back into the target bin and time delta
+// it was made from.
+type pairing struct{ targetBin, deltaMs int }
+
+// pairingsOf returns the pairings of the fingerprints whose anchor is bin.
+func pairingsOf(fingerprints []pkg.Fingerprint, anchorBin int) []pairing {
+	var pairings []pairing
+	for _, fp := range fingerprints {
+		if int(fp.Hash>>23) == anchorBin {
+			pairings = append(pairings, pairing{int(fp.Hash >> 14 & 0x1ff), int(fp.Hash & 0x3fff)})
+		}
+	}
+	return pairings
+}
+
+func TestFingerprintTargetZone(t *testing.T) {
+	config := DefaultFingerprintConfig()
+	config.TargetZone = TargetZone{MinTimeOffset: 0.01, MaxTimeOffset: 0.5, FreqSpan: 1000, Targets: 2}
+	// 1000 Hz is 93 bins of the default spectrogram. Bins are even so the
+	// quantization keeps them as they are.
+	anchor := Peak{Time: 0, Bin: 100}
+
+	tests := []struct {
+		name  string
+		later []Peak
+		want  []pairing
+	}{
+		{
+			name:  "peaks of the anchor's frame are skipped",
+			later: []Peak{{Time: 0, Bin: 110}, {Time: 0.005, Bin: 112}, {Time: 0.1, Bin: 120}},
+			want:  []pairing{{120, 100}},
+		},
+		{
+			name:  "peaks outside the frequency span are skipped",
+			later: []Peak{{Time: 0.1, Bin: 200}, {Time: 0.15, Bin: 6}, {Time: 0.2, Bin: 180}},
+			want:  []pairing{{180, 200}},
+		},
+		{
+			name:  "stops after Targets pairs",
+			later: []Peak{{Time: 0.1, Bin: 102}, {Time: 0.2, Bin: 104}, {Time: 0.3, Bin: 106}},
+			want:  []pairing{{102, 100}, {104, 200}},
+		},
+		{
+			name:  "stops at MaxTimeOffset",
+			later: []Peak{{Time: 0.4, Bin: 102}, {Time: 0.6, Bin: 104}},
+			want:  []pairing{{102, 400}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fingerprints, err := Fingerprint(append([]Peak{anchor}, tt.later...), "song", config)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := pairingsOf(fingerprints, anchor.Bin); !slices.Equal(got, tt.want) {
+				t.Errorf("pairings %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestFingerprintIgnoresPeakOrder(t *testing.T) {
+	// Peaks of 20 frames in three bands, listed band by band as a picker
+	// that walks bands in the outer loop would produce them.
+	var bandOrder []Peak
+	for _, bin := range []int{30, 90, 250} {
+		for frame := 0; frame < 20; frame++ {
+			bandOrder = append(bandOrder, Peak{Time: DefaultSpectrogramConfig().frameTime(frame * 7), Bin: bin + frame%5})
+		}
+	}
+	timeOrder := slices.Clone(bandOrder)
+	sortPeaks(timeOrder)
+
+	want, err := Fingerprint(timeOrder, "song", DefaultFingerprintConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Fingerprint(bandOrder, "song", DefaultFingerprintConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(want) == 0 || !slices.Equal(got, want) {
+		t.Errorf("band order gave %d fingerprints, time order %d, or they differ", len(got), len(want))
+	}
+}
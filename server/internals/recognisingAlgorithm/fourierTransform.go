@@ -1,45 +1,144 @@
 package recognisingalgorithm
 
 import (
+	"fmt"
 	"math"
-	"math/cmplx"
+	"math/bits"
 )
 
-func fftRealToComplex(x []float64) []complex128 {
-	N := len(x)
-	// Convert real input to complex
-	c := make([]complex128, N)
-	for i := range x {
-		c[i] = complex(x[i], 0)
+// FFTPlan holds the tables for an iterative, in-place radix-2 FFT of one
+// size. Building a plan costs one pass of trigonometry; every Transform after
+// that only does butterflies, so a single plan is meant to be reused for
+// every frame of a spectrogram.
+type FFTPlan struct {
+	n        int
+	twiddles []complex128 // e^(-2πik/n) for k < n/2
+	reversed []int        // Bit-reversed position of every index
+}
+
+// NewFFTPlan prepares a plan for transforms of length n, which must be a
+// power of two.
+func NewFFTPlan(n int) (*FFTPlan, error) {
+	if n < 1 || n&(n-1) != 0 {
+		return nil, fmt.Errorf("fft size must be a power of two, got %d", n)
+	}
+
+	twiddles := make([]complex128, n/2)
+	for k := range twiddles {
+		angle := -2 * math.Pi * float64(k) / float64(n)
+		twiddles[k] = complex(math.Cos(angle), math.Sin(angle))
+	}
+
+	reversed := make([]int, n)
+	shift := bits.UintSize - bits.Len(uint(n-1))
+	for i := range reversed {
+		if n > 1 {
+			reversed[i] = int(bits.Reverse(uint(i)) >> shift)
+		}
+	}
+	return &FFTPlan{n: n, twiddles: twiddles, reversed: reversed}, nil
+}
+
+// Size returns the transform length of the plan.
+func (p *FFTPlan) Size() int {
+	return p.n
+}
+
+// Transform replaces x with its discrete Fourier transform without
+// allocating. len(x) must equal the plan size.
+func (p *FFTPlan) Transform(x []complex128) {
+	if len(x) != p.n {
+		panic(fmt.Sprintf("fft plan of size %d used on %d samples", p.n, len(x)))
+	}
+
+	for i, j := range p.reversed {
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
 	}
 
-	return fft(c)
+	for size := 2; size <= p.n; size <<= 1 {
+		half := size / 2
+		step := p.n / size
+		for start := 0; start < p.n; start += size {
+			for k := 0; k < half; k++ {
+				t := p.twiddles[k*step] * x[start+k+half]
+				x[start+k+half] = x[start+k] - t
+				x[start+k] += t
+			}
+		}
+	}
+}
+
+// RealFFTPlan transforms n real samples by packing them into an n/2 point
+// complex FFT and untangling the result. Real input has a mirrored spectrum,
+// so only the n/2+1 non-redundant bins, DC to Nyquist, are produced.
+type RealFFTPlan struct {
+	n        int
+	half     *FFTPlan
+	twiddles []complex128 // e^(-2πik/n) for k <= n/4
 }
 
-func fft(x []complex128) []complex128 {
-	N := len(x)
-	if N <= 1 {
-		return x
+// NewRealFFTPlan prepares a plan for real transforms of length n, which must
+// be a power of two of at least 2.
+func NewRealFFTPlan(n int) (*RealFFTPlan, error) {
+	if n < 2 || n&(n-1) != 0 {
+		return nil, fmt.Errorf("real fft size must be a power of two of at least 2, got %d", n)
+	}
+	half, err := NewFFTPlan(n / 2)
+	if err != nil {
+		return nil, err
 	}
+	twiddles := make([]complex128, n/4+1)
+	for k := range twiddles {
+		angle := -2 * math.Pi * float64(k) / float64(n)
+		twiddles[k] = complex(math.Cos(angle), math.Sin(angle))
+	}
+	return &RealFFTPlan{n: n, half: half, twiddles: twiddles}, nil
+}
 
-	// Split even and odd
-	even := make([]complex128, N/2)
-	odd := make([]complex128, N/2)
-	for i := 0; i < N/2; i++ {
-		even[i] = x[2*i]
-		odd[i] = x[2*i+1]
+// Size returns the number of real samples the plan transforms.
+func (p *RealFFTPlan) Size() int {
+	return p.n
+}
+
+// Bins returns the number of frequency bins produced, n/2+1.
+func (p *RealFFTPlan) Bins() int {
+	return p.n/2 + 1
+}
+
+// Transform writes the spectrum of x into out without allocating.
+// len(x) must equal the plan size and len(out) must equal Bins().
+func (p *RealFFTPlan) Transform(x []float64, out []complex128) {
+	m := p.n / 2
+	if len(x) != p.n || len(out) != m+1 {
+		panic(fmt.Sprintf("real fft plan of size %d used on %d samples into %d bins", p.n, len(x), len(out)))
 	}
 
-	// Recursive FFT
-	Feven := fft(even)
-	Fodd := fft(odd)
+	// Even samples become the real parts, odd samples the imaginary parts.
+	for k := 0; k < m; k++ {
+		out[k] = complex(x[2*k], x[2*k+1])
+	}
+	p.half.Transform(out[:m])
 
-	// Combine
-	combined := make([]complex128, N)
-	for k := 0; k < N/2; k++ {
-		twiddle := cmplx.Exp(complex(0, -2*math.Pi*float64(k)/float64(N)))
-		combined[k] = Feven[k] + twiddle*Fodd[k]
-		combined[k+N/2] = Feven[k] - twiddle*Fodd[k]
+	// Split Z into the spectra of the even (E) and odd (O) samples and
+	// recombine: X[k] = E[k] + W^k O[k], working on k and m-k together so
+	// the untangling can happen in place.
+	z0 := out[0]
+	out[0] = complex(real(z0)+imag(z0), 0)
+	out[m] = complex(real(z0)-imag(z0), 0)
+	for k := 1; k <= m/2; k++ {
+		zk, zmk := out[k], out[m-k]
+		even := (zk + conj(zmk)) / 2
+		odd := (zk - conj(zmk)) * complex(0, -0.5)
+		evenMirror := (zmk + conj(zk)) / 2
+		oddMirror := (zmk - conj(zk)) * complex(0, -0.5)
+		// W^(m-k) = -conj(W^k)
+		out[k] = even + p.twiddles[k]*odd
+		out[m-k] = evenMirror - conj(p.twiddles[k])*oddMirror
 	}
-	return combined
+}
+
+func conj(c complex128) complex128 {
+	return complex(real(c), -imag(c))
 }
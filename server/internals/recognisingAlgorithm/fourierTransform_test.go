@@ -0,0 +1,148 @@
+package recognisingalgorithm
+
+import (
+	"math"
+	"math/cmplx"
+	"math/rand"
+	"testing"
+)
+
+// recursiveFFT is the allocating recursive FFT the plans replaced, kept as
+// the baseline for the benchmarks.
+func recursiveFFT(x []complex128) []complex128 {
+	N := len(x)
+	if N <= 1 {
+		return x
+	}
+
+	even := make([]complex128, N/2)
+	odd := make([]complex128, N/2)
+	for i := 0; i < N/2; i++ {
+		even[i] = x[2*i]
+		odd[i] = x[2*i+1]
+	}
+	Feven := recursiveFFT(even)
+	Fodd := recursiveFFT(odd)
+
+	combined := make([]complex128, N)
+	for k := 0; k < N/2; k++ {
+		twiddle := cmplx.Exp(complex(0, -2*math.Pi*float64(k)/float64(N)))
+		combined[k] = Feven[k] + twiddle*Fodd[k]
+		combined[k+N/2] = Feven[k] - twiddle*Fodd[k]
+	}
+	return combined
+}
+
+// naiveDFT evaluates the DFT straight from its definition.
+func naiveDFT(x []complex128) []complex128 {
+	n := len(x)
+	out := make([]complex128, n)
+	for k := range out {
+		for t, v := range x {
+			angle := -2 * math.Pi * float64(k*t%n) / float64(n)
+			out[k] += v * complex(math.Cos(angle), math.Sin(angle))
+		}
+	}
+	return out
+}
+
+func randomSignal(n int, seed int64) []float64 {
+	rng := rand.New(rand.NewSource(seed))
+	x := make([]float64, n)
+	for i := range x {
+		x[i] = rng.Float64()*2 - 1
+	}
+	return x
+}
+
+func toComplex(x []float64) []complex128 {
+	c := make([]complex128, len(x))
+	for i, v := range x {
+		c[i] = complex(v, 0)
+	}
+	return c
+}
+
+func assertSpectraClose(t *testing.T, got, want []complex128) {
+	t.Helper()
+	for k := range want {
+		if cmplx.Abs(got[k]-want[k]) > 1e-9 {
+			t.Fatalf("bin %d = %v, want %v", k, got[k], want[k])
+		}
+	}
+}
+
+func TestFFTPlanMatchesDFT(t *testing.T) {
+	for _, n := range []int{1, 2, 4, 8, 64, 1024} {
+		rng := rand.New(rand.NewSource(int64(n)))
+		x := make([]complex128, n)
+		for i := range x {
+			x[i] = complex(rng.Float64()*2-1, rng.Float64()*2-1)
+		}
+		want := naiveDFT(x)
+
+		plan, err := NewFFTPlan(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plan.Transform(x)
+		assertSpectraClose(t, x, want)
+	}
+}
+
+func TestRealFFTPlanMatchesDFT(t *testing.T) {
+	for _, n := range []int{2, 4, 16, 256, 1024} {
+		x := randomSignal(n, int64(n))
+		want := naiveDFT(toComplex(x))
+
+		plan, err := NewRealFFTPlan(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		out := make([]complex128, plan.Bins())
+		plan.Transform(x, out)
+		assertSpectraClose(t, out, want[:plan.Bins()])
+	}
+}
+
+func TestNewFFTPlanRejectsOtherSizes(t *testing.T) {
+	for _, n := range []int{0, 3, 1000} {
+		if _, err := NewFFTPlan(n); err == nil {
+			t.Errorf("NewFFTPlan(%d) succeeded", n)
+		}
+	}
+	if _, err := NewRealFFTPlan(1); err == nil {
+		t.Error("NewRealFFTPlan(1) succeeded")
+	}
+}
+
+const benchmarkFFTSize = 1024
+
+func BenchmarkRecursiveFFT(b *testing.B) {
+	x := toComplex(randomSignal(benchmarkFFTSize, 1))
+	b.ReportAllocs()
+	for b.Loop() {
+		recursiveFFT(x)
+	}
+}
+
+func BenchmarkFFTPlan(b *testing.B) {
+	x := toComplex(randomSignal(benchmarkFFTSize, 1))
+	plan, _ := NewFFTPlan(benchmarkFFTSize)
+	buf := make([]complex128, benchmarkFFTSize)
+	b.ReportAllocs()
+	for b.Loop() {
+		copy(buf, x)
+		plan.Transform(buf)
+	}
+}
+
+func BenchmarkRealFFTPlan(b *testing.B) {
+	x := randomSignal(benchmarkFFTSize, 1)
+	plan, _ := NewRealFFTPlan(benchmarkFFTSize)
+	out := make([]complex128, plan.Bins())
+	b.ReportAllocs()
+	for b.Loop() {
+		plan.Transform(x, out)
+	}
+}
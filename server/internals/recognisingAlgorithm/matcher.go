@@ -0,0 +1,152 @@
+package recognisingalgorithm
+
+import (
+	"sort"
+
+	"github.com/Pritam-deb/echo-sense/pkg"
+)
+
+const (
+	defaultOffsetBinMs      = 100 // Width of an offset histogram bin, absorbs peak timing jitter
+	defaultMinAlignedHashes = 5   // Fewer aligned hashes than this is treated as noise
+)
+
+// Candidate is a song that shares time-aligned hashes with a query.
+type Candidate struct {
+	SongID        string
+	Offset        float64 // Seconds into the song where the query starts
+	AlignedHashes int     // Number of hashes agreeing on Offset
+	Score         float64 // AlignedHashes normalised by the query size, in [0, 1]
+}
+
+// Matcher scores songs against a query by building, per song, a histogram of
+// the differences between stored and query anchor times. A true match shows
+// up as a single tall bin: the offset at which the query sits in the song.
+//
+// A Matcher accumulates evidence across calls to Add, so a query can be fed
+// in pieces as its fingerprints become available.
+type Matcher struct {
+	OffsetBinMs      int
+	MinAlignedHashes int
+
+	histograms  map[string]map[int]int           // Aligned hashes per song and offset bin
+	pairs       map[string]map[pairKey]*pairings // Anchors behind the votes of each song, offset bin and hash
+	queryHashes int
+}
+
+// pairKey identifies the votes one hash casts into one offset bin.
+type pairKey struct {
+	bin  int
+	hash uint32
+}
+
+// pairings holds the distinct query and stored anchors of a hash that agree
+// on an offset bin. Only as many of them align as the smaller side holds.
+type pairings struct {
+	query, stored map[uint32]struct{}
+}
+
+func (p *pairings) aligned() int {
+	return min(len(p.query), len(p.stored))
+}
+
+// NewMatcher returns a Matcher with the default bin width and threshold.
+func NewMatcher() *Matcher {
+	return &Matcher{
+		OffsetBinMs:      defaultOffsetBinMs,
+		MinAlignedHashes: defaultMinAlignedHashes,
+		histograms:       map[string]map[int]int{},
+		pairs:            map[string]map[pairKey]*pairings{},
+	}
+}
+
+// Add votes for every stored fingerprint that shares a hash with the query.
+// Both sides may hold several anchors for the same hash. Each query and each
+// stored anchor aligns at most once per offset bin, so a bin counts a hash as
+// often as the smaller side holds it there, and a bin never holds more
+// aligned hashes than the query has fingerprints.
+func (m *Matcher) Add(query []pkg.Fingerprint, stored []pkg.Fingerprint) {
+	m.queryHashes += len(query)
+	queryAnchors := map[uint32][]uint32{}
+	for _, fp := range query {
+		queryAnchors[fp.Hash] = append(queryAnchors[fp.Hash], fp.AnchorTime)
+	}
+
+	for _, fp := range stored {
+		anchors, ok := queryAnchors[fp.Hash]
+		if !ok {
+			continue
+		}
+		hist, ok := m.histograms[fp.SongID]
+		if !ok {
+			hist = map[int]int{}
+			m.histograms[fp.SongID] = hist
+			m.pairs[fp.SongID] = map[pairKey]*pairings{}
+		}
+		songPairs := m.pairs[fp.SongID]
+		for _, queryAnchor := range anchors {
+			delta := int(fp.AnchorTime) - int(queryAnchor)
+			key := pairKey{bin: floorDiv(delta, m.OffsetBinMs), hash: fp.Hash}
+			p, ok := songPairs[key]
+			if !ok {
+				p = &pairings{query: map[uint32]struct{}{}, stored: map[uint32]struct{}{}}
+				songPairs[key] = p
+			}
+			before := p.aligned()
+			p.query[queryAnchor] = struct{}{}
+			p.stored[fp.AnchorTime] = struct{}{}
+			hist[key.bin] += p.aligned() - before
+		}
+	}
+}
+
+// Candidates returns every song whose best offset bin reaches
+// MinAlignedHashes, ranked by the number of aligned hashes.
+func (m *Matcher) Candidates() []Candidate {
+	var candidates []Candidate
+	for songID, hist := range m.histograms {
+		bestBin, bestCount := 0, 0
+		for bin, count := range hist {
+			if count > bestCount || (count == bestCount && bin < bestBin) {
+				bestBin, bestCount = bin, count
+			}
+		}
+		if bestCount < m.MinAlignedHashes {
+			continue
+		}
+		score := 0.0
+		if m.queryHashes > 0 {
+			score = float64(bestCount) / float64(m.queryHashes)
+		}
+		candidates = append(candidates, Candidate{
+			SongID:        songID,
+			Offset:        float64(bestBin*m.OffsetBinMs) / 1000,
+			AlignedHashes: bestCount,
+			Score:         score,
+		})
+	}
+	sort.Slice(candidates, func(i, j int) bool {
+		if candidates[i].AlignedHashes != candidates[j].AlignedHashes {
+			return candidates[i].AlignedHashes > candidates[j].AlignedHashes
+		}
+		return candidates[i].SongID < candidates[j].SongID
+	})
+	return candidates
+}
+
+// Match scores a complete query in one go.
+func Match(query []pkg.Fingerprint, stored []pkg.Fingerprint) []Candidate {
+	m := NewMatcher()
+	m.Add(query, stored)
+	return m.Candidates()
+}
+
+// floorDiv divides rounding towards negative infinity so that small negative
+// and positive deltas do not share bin zero.
+func floorDiv(a, b int) int {
+	q := a / b
+	if (a%b != 0) && ((a < 0) != (b < 0)) {
+		q--
+	}
+	return q
+}
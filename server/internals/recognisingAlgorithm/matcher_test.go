@@ -0,0 +1,114 @@
+package recognisingalgorithm
+
+import (
+	"math"
+	"testing"
+
+	"github.com/Pritam-deb/echo-sense/pkg"
+)
+
+func fingerprint(hash uint32, songID string, anchorMs uint32) pkg.Fingerprint {
+	return pkg.Fingerprint{Hash: hash, Couple: pkg.Couple{SongID: songID, AnchorTime: anchorMs}}
+}
+
+// clip returns hashes 1..n anchored every 100 ms from startMs on.
+func clip(n int, songID string, startMs uint32) []pkg.Fingerprint {
+	fps := make([]pkg.Fingerprint, n)
+	for i := range fps {
+		fps[i] = fingerprint(uint32(i+1), songID, startMs+uint32(i)*100)
+	}
+	return fps
+}
+
+func TestMatch(t *testing.T) {
+	query := clip(10, "", 0)
+
+	// The query's hashes, each anchored at a different, unrelated offset.
+	var scattered []pkg.Fingerprint
+	for i, fp := range clip(10, "other", 0) {
+		fp.AnchorTime = uint32(i * 1700)
+		scattered = append(scattered, fp)
+	}
+
+	// The song repeats hash 1 three times within one offset bin.
+	repeated := append(clip(10, "song", 12000),
+		fingerprint(1, "song", 12020),
+		fingerprint(1, "song", 12040))
+
+	tests := []struct {
+		name   string
+		query  []pkg.Fingerprint
+		stored []pkg.Fingerprint
+		want   []Candidate
+	}{
+		{
+			name:   "known offset",
+			query:  query,
+			stored: clip(10, "song", 12000),
+			want:   []Candidate{{SongID: "song", Offset: 12, AlignedHashes: 10, Score: 1}},
+		},
+		{
+			name:   "wrong song",
+			query:  query,
+			stored: scattered,
+			want:   nil,
+		},
+		{
+			name:   "right song ranked above wrong song",
+			query:  query,
+			stored: append(scattered, clip(7, "song", 3000)...),
+			want:   []Candidate{{SongID: "song", Offset: 3, AlignedHashes: 7, Score: 0.7}},
+		},
+		{
+			name:   "repeated stored hash",
+			query:  query,
+			stored: repeated,
+			want:   []Candidate{{SongID: "song", Offset: 12, AlignedHashes: 10, Score: 1}},
+		},
+		{
+			name:   "repeated query hash",
+			query:  append(clip(10, "", 0), fingerprint(1, "", 20), fingerprint(1, "", 40)),
+			stored: repeated,
+			want:   []Candidate{{SongID: "song", Offset: 12, AlignedHashes: 12, Score: 1}},
+		},
+		{
+			name:   "repeated query hash, stored once",
+			query:  append(clip(10, "", 0), fingerprint(1, "", 20), fingerprint(1, "", 40)),
+			stored: clip(10, "song", 12000),
+			want:   []Candidate{{SongID: "song", Offset: 12, AlignedHashes: 10, Score: 10.0 / 12}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Match(tt.query, tt.stored)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d candidates %+v, want %+v", len(got), got, tt.want)
+			}
+			for i, want := range tt.want {
+				g := got[i]
+				if g.SongID != want.SongID || g.AlignedHashes != want.AlignedHashes ||
+					math.Abs(g.Offset-want.Offset) > 1e-9 || math.Abs(g.Score-want.Score) > 1e-9 {
+					t.Errorf("candidate %d = %+v, want %+v", i, g, want)
+				}
+				if g.Score > 1 {
+					t.Errorf("candidate %d has score %v above 1", i, g.Score)
+				}
+			}
+		})
+	}
+}
+
+func TestMatcherAddInPieces(t *testing.T) {
+	query := clip(10, "", 0)
+	stored := clip(10, "song", 12000)
+	want := Match(query, stored)
+
+	m := NewMatcher()
+	m.Add(query[:4], stored)
+	m.Add(query[4:], stored)
+	got := m.Candidates()
+	if len(got) != 1 || got[0] != want[0] {
+		t.Errorf("got %+v, want %+v", got, want)
+	}
+}
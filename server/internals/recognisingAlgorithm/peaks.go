@@ -0,0 +1,434 @@
+package recognisingalgorithm
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+)
+
+// PeakStrategy selects the local maximum test a bin must pass to be a peak.
+type PeakStrategy string
+
+const (
+	// PeakStrategyBand keeps bins that beat their neighbours within the band
+	// of the same frame, and the same bins of the frames around it. A steady
+	// tone stays a maximum frame after frame, so it yields a peak in each.
+	PeakStrategyBand PeakStrategy = "band"
+	// PeakStrategyMaxFilter runs a sliding maximum filter over the
+	// time×frequency neighbourhood, across band edges, and keeps bins equal
+	// to the maximum of their window. Ties go to the earliest frame and lowest
+	// bin, so a steady tone yields one peak at its onset and the constellation
+	// is sparser.
+	PeakStrategyMaxFilter PeakStrategy = "maxfilter"
+)
+
+// BandLayout selects how the spectrum is split into the bands peaks are
+// picked from.
+type BandLayout string
+
+const (
+	BandLayoutEdges BandLayout = "edges" // The explicit BandEdges
+	BandLayoutMel   BandLayout = "mel"   // Bands equally wide on the mel scale, narrow at the bottom where pitch is resolved finely
+	BandLayoutLog   BandLayout = "log"   // Bands equally wide in octaves
+)
+
+// PeakPickerConfig controls how densely peaks are picked from a spectrogram.
+// Denser settings suit noisy phone recordings, sparser ones clean masters.
+// A peak must be a local maximum, by Strategy, within FreqNeighbourhood bins
+// and TimeNeighbourhood frames, and must reach mean + ThresholdFactor·std of
+// its band in its own frame. The strongest PeaksPerBand such peaks of every
+// band and frame are kept.
+//
+// Picking only changes which hashes a clip produces, not what a hash means,
+// so songs and clips may be picked with different settings as long as the
+// spectrogram config matches.
+type PeakPickerConfig struct {
+	Strategy          PeakStrategy
+	Layout            BandLayout
+	BandEdges         []float64 // Band boundaries in Hz for BandLayoutEdges, ascending; band i spans [BandEdges[i], BandEdges[i+1])
+	Bands             int       // Number of bands for BandLayoutMel and BandLayoutLog
+	MinHz, MaxHz      float64   // Range split by BandLayoutMel and BandLayoutLog; a MaxHz of 0 means the Nyquist frequency
+	PeaksPerBand      int       // Peaks kept per band per frame
+	FreqNeighbourhood int       // Bins either side a peak must exceed
+	TimeNeighbourhood int       // Frames either side a peak must exceed; each adds one hop of latency to streams
+	ThresholdFactor   float64   // Standard deviations above the band mean a peak must reach
+}
+
+// DefaultPeakPickerConfig keeps the three strongest peaks of each of six
+// octave-like bands, whose edges fall on bins 0, 10, 20, 40, 80, 160 and 512
+// of the default spectrogram.
+func DefaultPeakPickerConfig() PeakPickerConfig {
+	return PeakPickerConfig{
+		Strategy:          PeakStrategyBand,
+		Layout:            BandLayoutEdges,
+		BandEdges:         []float64{0, 108, 216, 431, 862, 1723, 5512},
+		Bands:             6,  // For BandLayoutMel and BandLayoutLog
+		MinHz:             50, // Below this is mostly rumble
+		PeaksPerBand:      3,
+		FreqNeighbourhood: 1,
+		TimeNeighbourhood: 0,
+		ThresholdFactor:   0.5,
+	}
+}
+
+// ParsePeakStrategy validates the name of a peak strategy.
+func ParsePeakStrategy(name string) (PeakStrategy, error) {
+	switch strategy := PeakStrategy(name); strategy {
+	case PeakStrategyBand, PeakStrategyMaxFilter:
+		return strategy, nil
+	}
+	return "", fmt.Errorf("unknown peak strategy %q, expected band or maxfilter", name)
+}
+
+// ParseBandLayout validates the name of a band layout.
+func ParseBandLayout(name string) (BandLayout, error) {
+	switch layout := BandLayout(name); layout {
+	case BandLayoutEdges, BandLayoutMel, BandLayoutLog:
+		return layout, nil
+	}
+	return "", fmt.Errorf("unknown band layout %q, expected edges, mel or log", name)
+}
+
+// Validate reports whether the config can be used to pick peaks.
+func (c PeakPickerConfig) Validate() error {
+	if _, err := ParsePeakStrategy(string(c.Strategy)); err != nil {
+		return err
+	}
+	switch c.Layout {
+	case BandLayoutEdges:
+		if len(c.BandEdges) < 2 {
+			return fmt.Errorf("need at least two band edges, got %d", len(c.BandEdges))
+		}
+		for i, edge := range c.BandEdges {
+			if edge < 0 || (i > 0 && edge <= c.BandEdges[i-1]) {
+				return fmt.Errorf("band edges must be non-negative and ascending, got %v", c.BandEdges)
+			}
+		}
+	case BandLayoutMel, BandLayoutLog:
+		if c.Bands < 1 {
+			return fmt.Errorf("%s layout needs a positive number of bands, got %d", c.Layout, c.Bands)
+		}
+		if c.MinHz < 0 || (c.Layout == BandLayoutLog && c.MinHz == 0) {
+			return fmt.Errorf("%s layout cannot start at %v Hz", c.Layout, c.MinHz)
+		}
+		if c.MaxHz != 0 && c.MaxHz <= c.MinHz {
+			return fmt.Errorf("band range %v-%v Hz is empty", c.MinHz, c.MaxHz)
+		}
+	default:
+		return fmt.Errorf("unknown band layout %q, expected edges, mel or log", c.Layout)
+	}
+	if c.PeaksPerBand < 1 {
+		return fmt.Errorf("peaks per band must be positive, got %d", c.PeaksPerBand)
+	}
+	if c.FreqNeighbourhood < 0 || c.TimeNeighbourhood < 0 {
+		return fmt.Errorf("neighbourhoods cannot be negative, got %d bins and %d frames", c.FreqNeighbourhood, c.TimeNeighbourhood)
+	}
+	if math.IsNaN(c.ThresholdFactor) || math.IsInf(c.ThresholdFactor, 0) {
+		return fmt.Errorf("threshold factor must be finite, got %v", c.ThresholdFactor)
+	}
+	return nil
+}
+
+// peakBand is a band as (min, max) bin indices, max exclusive.
+type peakBand struct{ min, max int }
+
+// bandEdges returns the band boundaries in Hz for spectrograms computed with
+// spectrogram, whose sample rate fixes the Nyquist frequency.
+func (c PeakPickerConfig) bandEdges(spectrogram SpectrogramConfig) []float64 {
+	if c.Layout == BandLayoutEdges {
+		return c.BandEdges
+	}
+	maxHz := c.MaxHz
+	if maxHz == 0 {
+		maxHz = float64(spectrogram.TargetSampleRate) / 2
+	}
+	// Space the edges evenly on the layout's scale, then map them back to Hz.
+	toScale, fromScale := hzToMel, melToHz
+	if c.Layout == BandLayoutLog {
+		toScale, fromScale = math.Log2, math.Exp2
+	}
+	low, high := toScale(c.MinHz), toScale(maxHz)
+	edges := make([]float64, c.Bands+1)
+	for i := range edges {
+		edges[i] = fromScale(low + float64(i)/float64(c.Bands)*(high-low))
+	}
+	return edges
+}
+
+// hzToMel converts a frequency to the mel scale.
+func hzToMel(hz float64) float64 {
+	return 2595 * math.Log10(1+hz/700)
+}
+
+// melToHz converts a mel scale value back to a frequency.
+func melToHz(mel float64) float64 {
+	return 700 * (math.Pow(10, mel/2595) - 1)
+}
+
+// bands converts the band edges to bins of spectrograms computed with
+// spectrogram, dropping bands narrower than one bin. The Nyquist bin is left
+// out, which keeps every bin within the maxFreqBits of a hash.
+func (c PeakPickerConfig) bands(spectrogram SpectrogramConfig) []peakBand {
+	bins := spectrogram.FrameSize / 2
+	edges := c.bandEdges(spectrogram)
+	var bands []peakBand
+	for i := 1; i < len(edges); i++ {
+		band := peakBand{min(spectrogram.hzToBin(edges[i-1]), bins), min(spectrogram.hzToBin(edges[i]), bins)}
+		if band.max > band.min {
+			bands = append(bands, band)
+		}
+	}
+	return bands
+}
+
+// ExtractPeaks analyzes a spectrogram and extracts significant local maxima peaks in each frequency band over time.
+// It collects the top N peaks per band per time bin, using local maxima detection and adaptive thresholding.
+// Each spectrogram row holds the FrameSize/2+1 non-redundant bins produced by the real FFT.
+// Rows are timed by the hop, as in StreamFingerprinter, so both give the same peaks.
+func ExtractPeaks(spectrogram [][]complex128, config FingerprintConfig) ([]Peak, error) {
+	picker, err := newPeakPicker(config)
+	if err != nil {
+		return nil, err
+	}
+	if len(spectrogram) < 1 {
+		return []Peak{}, nil
+	}
+
+	var peaks []Peak
+	for binIdx, bin := range spectrogram {
+		peaks = picker.add(bin, config.Spectrogram.frameTime(binIdx), peaks)
+	}
+	return picker.flush(peaks), nil
+}
+
+// peakFrame is a spectrogram row kept by a peakPicker.
+type peakFrame struct {
+	time float64
+	row  []complex128
+	mags []float64
+	fmax []float64 // Sliding maximum of mags over the frequency neighbourhood, for PeakStrategyMaxFilter
+}
+
+// peakPicker picks peaks from spectrogram rows fed to it in time order. A
+// frame's peaks are known once the TimeNeighbourhood frames after it have
+// arrived, so that many frames are held back, along with as many before them
+// for comparison.
+type peakPicker struct {
+	config   PeakPickerConfig
+	bands    []peakBand
+	window   []*peakFrame // Recent frames, oldest first
+	unpicked int          // Frames at the end of window whose peaks are not yet picked
+	free     []*peakFrame // Frames dropped from window, for reuse
+}
+
+func newPeakPicker(config FingerprintConfig) (*peakPicker, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	return &peakPicker{config: config.Peaks, bands: config.Peaks.bands(config.Spectrogram)}, nil
+}
+
+// add queues the row found at time and appends the peaks of every frame that
+// is now complete to peaks.
+func (p *peakPicker) add(row []complex128, time float64, peaks []Peak) []Peak {
+	var frame *peakFrame
+	if n := len(p.free); n > 0 {
+		frame, p.free = p.free[n-1], p.free[:n-1]
+	} else {
+		frame = &peakFrame{}
+	}
+	frame.time = time
+	frame.row = append(frame.row[:0], row...)
+	frame.mags = frame.mags[:0]
+	for _, v := range row {
+		frame.mags = append(frame.mags, cmplx.Abs(v))
+	}
+	if p.config.Strategy == PeakStrategyMaxFilter {
+		frame.fmax = slidingMax(frame.mags, p.config.FreqNeighbourhood, frame.fmax)
+	}
+	p.window = append(p.window, frame)
+	p.unpicked++
+
+	reach := p.config.TimeNeighbourhood
+	if p.unpicked > reach {
+		peaks = p.pick(len(p.window)-p.unpicked, peaks)
+		p.unpicked--
+	}
+	// Later frames only look back as far as the oldest unpicked frame's
+	// neighbourhood.
+	if drop := len(p.window) - p.unpicked - reach; drop > 0 {
+		p.free = append(p.free, p.window[:drop]...)
+		n := copy(p.window, p.window[drop:])
+		clear(p.window[n:])
+		p.window = p.window[:n]
+	}
+	return peaks
+}
+
+// flush appends the peaks of the frames still held back, whose time
+// neighbourhoods are cut short by the end of the audio.
+func (p *peakPicker) flush(peaks []Peak) []Peak {
+	for ; p.unpicked > 0; p.unpicked-- {
+		peaks = p.pick(len(p.window)-p.unpicked, peaks)
+	}
+	return peaks
+}
+
+// pick appends the peaks of window[at] to peaks.
+func (p *peakPicker) pick(at int, peaks []Peak) []Peak {
+	frame := p.window[at]
+	from := max(at-p.config.TimeNeighbourhood, 0)
+	to := min(at+p.config.TimeNeighbourhood, len(p.window)-1)
+	for _, band := range p.bands {
+		if band.max > len(frame.mags) {
+			continue
+		}
+		mags := frame.mags[band.min:band.max]
+		// Find local maxima in this band.
+		type idxMag struct {
+			idx int
+			mag float64
+		}
+		var maxima []idxMag
+		if p.config.Strategy == PeakStrategyMaxFilter {
+			for idx := range mags {
+				if p.isFilterMax(from, to, at, band.min+idx) {
+					maxima = append(maxima, idxMag{idx: idx, mag: mags[idx]})
+				}
+			}
+		} else {
+			for _, idx := range findLocalMaxima(mags, p.config.FreqNeighbourhood) {
+				if p.beatsNeighbours(from, to, at, band.min+idx) {
+					maxima = append(maxima, idxMag{idx: idx, mag: mags[idx]})
+				}
+			}
+		}
+		// Sort by descending magnitude.
+		for i := 0; i < len(maxima); i++ {
+			for j := i + 1; j < len(maxima); j++ {
+				if maxima[j].mag > maxima[i].mag {
+					maxima[i], maxima[j] = maxima[j], maxima[i]
+				}
+			}
+		}
+		// Adaptive threshold: use mean + stddev of band.
+		var sum, sumSq float64
+		for _, v := range mags {
+			sum += v
+			sumSq += v * v
+		}
+		mean := sum / float64(len(mags))
+		std := 0.0
+		if len(mags) > 1 {
+			std = (sumSq/float64(len(mags)) - mean*mean)
+			if std > 0 {
+				std = math.Sqrt(std)
+			} else {
+				std = 0
+			}
+		}
+		threshold := mean + std*p.config.ThresholdFactor
+		// Take up to PeaksPerBand maxima above threshold.
+		count := 0
+		for _, m := range maxima {
+			if m.mag < threshold {
+				break
+			}
+			freqIdx := band.min + m.idx
+			peaks = append(peaks, Peak{
+				Time: frame.time,
+				Freq: frame.row[freqIdx],
+				Mag:  m.mag,
+				Bin:  freqIdx,
+			})
+			count++
+			if count >= p.config.PeaksPerBand {
+				break
+			}
+		}
+	}
+	return peaks
+}
+
+// beatsNeighbours reports whether bin of window[at] exceeds the bins within
+// FreqNeighbourhood of it in the frames window[from:to+1] around it.
+func (p *peakPicker) beatsNeighbours(from, to, at, bin int) bool {
+	mag := p.window[at].mags[bin]
+	for t := from; t <= to; t++ {
+		if t == at {
+			continue
+		}
+		mags := p.window[t].mags
+		for j := max(bin-p.config.FreqNeighbourhood, 0); j <= min(bin+p.config.FreqNeighbourhood, len(mags)-1); j++ {
+			if mags[j] >= mag {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// isFilterMax reports whether bin of window[at] survives the maximum filter
+// over the frames window[from:to+1]: it must equal the largest value of its
+// neighbourhood and beat any equal value in an earlier frame or lower bin.
+func (p *peakPicker) isFilterMax(from, to, at, bin int) bool {
+	frame := p.window[at]
+	mag := frame.mags[bin]
+	if mag == 0 || mag < frame.fmax[bin] {
+		return false
+	}
+	for j := max(bin-p.config.FreqNeighbourhood, 0); j < bin; j++ {
+		if frame.mags[j] >= mag {
+			return false
+		}
+	}
+	for t := from; t <= to; t++ {
+		if t < at && p.window[t].fmax[bin] >= mag || t > at && p.window[t].fmax[bin] > mag {
+			return false
+		}
+	}
+	return true
+}
+
+// slidingMax writes to dst, reusing its storage, the maximum of values within
+// reach of every index. A deque of candidate indices with falling values makes
+// it linear in len(values) whatever the reach.
+func slidingMax(values []float64, reach int, dst []float64) []float64 {
+	dst = dst[:0]
+	deque := make([]int, 0, 2*reach+1)
+	next := 0 // Next index to enter the window
+	for i := range values {
+		for ; next < len(values) && next <= i+reach; next++ {
+			for len(deque) > 0 && values[deque[len(deque)-1]] <= values[next] {
+				deque = deque[:len(deque)-1]
+			}
+			deque = append(deque, next)
+		}
+		for deque[0] < i-reach {
+			deque = deque[1:]
+		}
+		dst = append(dst, values[deque[0]])
+	}
+	return dst
+}
+
+// findLocalMaxima finds local maxima in a slice of magnitudes.
+func findLocalMaxima(mags []float64, window int) []int {
+	var idxs []int
+	for i := window; i < len(mags)-window; i++ {
+		isMax := true
+		for j := i - window; j <= i+window; j++ {
+			if j == i {
+				continue
+			}
+			if mags[j] >= mags[i] {
+				isMax = false
+				break
+			}
+		}
+		if isMax {
+			idxs = append(idxs, i)
+		}
+	}
+	return idxs
+}
@@ -0,0 +1,234 @@
+package recognisingalgorithm
+
+import (
+	"fmt"
+	"math"
+	"slices"
+	"testing"
+)
+
+// tone sets the magnitude of bin in frames [from, to) of a spectrogram.
+type tone struct {
+	bin, from, to int
+	mag           float64
+}
+
+// toneSpectrogram builds frames rows of the default spectrogram, silent
+// apart from the given tones.
+func toneSpectrogram(frames int, tones ...tone) [][]complex128 {
+	spectrogram := make([][]complex128, frames)
+	for i := range spectrogram {
+		spectrogram[i] = make([]complex128, DefaultSpectrogramConfig().FrameSize/2+1)
+	}
+	for _, t := range tones {
+		for i := t.from; i < t.to; i++ {
+			spectrogram[i][t.bin] = complex(t.mag, 0)
+		}
+	}
+	return spectrogram
+}
+
+// peakAt is where a peak was found: its frame and bin.
+type peakAt struct{ frame, bin int }
+
+func pickPeaks(t *testing.T, spectrogram [][]complex128, peaks PeakPickerConfig) []peakAt {
+	t.Helper()
+	config := DefaultFingerprintConfig()
+	config.Peaks = peaks
+	found, err := ExtractPeaks(spectrogram, config)
+	if err != nil {
+		t.Fatal(err)
+	}
+	frame := config.Spectrogram.frameTime(1)
+	var at []peakAt
+	for _, p := range found {
+		at = append(at, peakAt{frame: int(p.Time/frame + 0.5), bin: p.Bin})
+	}
+	slices.SortFunc(at, func(a, b peakAt) int {
+		if a.frame != b.frame {
+			return a.frame - b.frame
+		}
+		return a.bin - b.bin
+	})
+	return at
+}
+
+func TestExtractPeaks(t *testing.T) {
+	band := DefaultPeakPickerConfig()
+	maxFilter := DefaultPeakPickerConfig()
+	maxFilter.Strategy = PeakStrategyMaxFilter
+	maxFilter.TimeNeighbourhood = 3
+	wideMaxFilter := maxFilter
+	wideMaxFilter.FreqNeighbourhood = 2
+
+	var everyFrame []peakAt
+	for i := 0; i < 10; i++ {
+		everyFrame = append(everyFrame, peakAt{i, 50})
+	}
+
+	tests := []struct {
+		name        string
+		spectrogram [][]complex128
+		peaks       PeakPickerConfig
+		want        []peakAt
+	}{
+		{
+			name:        "steady tone, band strategy",
+			spectrogram: toneSpectrogram(10, tone{bin: 50, from: 0, to: 10, mag: 10}),
+			peaks:       band,
+			want:        everyFrame,
+		},
+		{
+			name:        "steady tone, max filter",
+			spectrogram: toneSpectrogram(10, tone{bin: 50, from: 0, to: 10, mag: 10}),
+			peaks:       maxFilter,
+			want:        []peakAt{{0, 50}},
+		},
+		{
+			name:        "tones with different onsets, max filter",
+			spectrogram: toneSpectrogram(10, tone{bin: 50, from: 2, to: 10, mag: 10}, tone{bin: 120, from: 0, to: 10, mag: 10}),
+			peaks:       maxFilter,
+			want:        []peakAt{{0, 120}, {2, 50}},
+		},
+		{
+			name:        "equal bins in one frame, lower bin wins",
+			spectrogram: toneSpectrogram(3, tone{bin: 50, from: 1, to: 2, mag: 10}, tone{bin: 51, from: 1, to: 2, mag: 10}),
+			peaks:       maxFilter,
+			want:        []peakAt{{1, 50}},
+		},
+		{
+			name:        "equal frames, earlier frame wins",
+			spectrogram: toneSpectrogram(8, tone{bin: 50, from: 3, to: 5, mag: 10}),
+			peaks:       maxFilter,
+			want:        []peakAt{{3, 50}},
+		},
+		{
+			name:        "louder frame after an equal neighbourhood wins",
+			spectrogram: toneSpectrogram(8, tone{bin: 50, from: 2, to: 4, mag: 10}, tone{bin: 51, from: 4, to: 5, mag: 12}),
+			peaks:       maxFilter,
+			want:        []peakAt{{4, 51}},
+		},
+		{
+			// Bin 80 starts the 862 Hz band; bin 78 ends the one below.
+			name:        "neighbourhood across a band edge",
+			spectrogram: toneSpectrogram(3, tone{bin: 78, from: 1, to: 2, mag: 8}, tone{bin: 80, from: 1, to: 2, mag: 10}),
+			peaks:       wideMaxFilter,
+			want:        []peakAt{{1, 80}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := pickPeaks(t, tt.spectrogram, tt.peaks)
+			if !slices.Equal(got, tt.want) {
+				t.Errorf("peaks at %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSlidingMax(t *testing.T) {
+	values := []float64{3, 1, 4, 1, 5, 9, 2, 6, 5, 3}
+	for reach := 0; reach <= 4; reach++ {
+		got := slidingMax(values, reach, nil)
+		for i := range values {
+			want := slices.Max(values[max(i-reach, 0):min(i+reach+1, len(values))])
+			if got[i] != want {
+				t.Errorf("reach %d: index %d = %v, want %v", reach, i, got[i], want)
+			}
+		}
+	}
+}
+
+func TestParsePeakStrategy(t *testing.T) {
+	for _, name := range []string{"band", "maxfilter"} {
+		if strategy, err := ParsePeakStrategy(name); err != nil || string(strategy) != name {
+			t.Errorf("ParsePeakStrategy(%q) = %q, %v", name, strategy, err)
+		}
+	}
+	if _, err := ParsePeakStrategy("Band"); err == nil {
+		t.Error("ParsePeakStrategy accepted Band")
+	}
+}
+
+func TestMelScale(t *testing.T) {
+	if mel := hzToMel(1000); math.Abs(mel-1000) > 0.1 {
+		t.Errorf("hzToMel(1000) = %v, want about 1000", mel)
+	}
+	for _, hz := range []float64{0, 50, 440, 1000, 5512.5, 20000} {
+		if got := melToHz(hzToMel(hz)); math.Abs(got-hz) > 1e-9*max(hz, 1) {
+			t.Errorf("melToHz(hzToMel(%v)) = %v", hz, got)
+		}
+	}
+}
+
+func TestBandEdgesLayouts(t *testing.T) {
+	spectrogram := DefaultSpectrogramConfig()
+	nyquist := float64(spectrogram.TargetSampleRate) / 2
+	for _, tt := range []struct {
+		layout       BandLayout
+		minHz, maxHz float64
+		wantMax      float64
+	}{
+		{BandLayoutMel, 0, 0, nyquist},
+		{BandLayoutMel, 50, 4000, 4000},
+		{BandLayoutLog, 50, 0, nyquist},
+		{BandLayoutLog, 100, 3200, 3200},
+	} {
+		config := PeakPickerConfig{Layout: tt.layout, Bands: 8, MinHz: tt.minHz, MaxHz: tt.maxHz}
+		edges := config.bandEdges(spectrogram)
+		name := fmt.Sprintf("%s %v-%v Hz", tt.layout, tt.minHz, tt.maxHz)
+		if len(edges) != config.Bands+1 {
+			t.Fatalf("%s: %d edges, want %d", name, len(edges), config.Bands+1)
+		}
+		if math.Abs(edges[0]-tt.minHz) > 1e-9 || math.Abs(edges[len(edges)-1]-tt.wantMax) > 1e-6 {
+			t.Errorf("%s: edges run from %v to %v Hz", name, edges[0], edges[len(edges)-1])
+		}
+		for i := 1; i < len(edges); i++ {
+			if edges[i] <= edges[i-1] {
+				t.Errorf("%s: edges %v are not ascending", name, edges)
+				break
+			}
+		}
+		if tt.layout == BandLayoutLog {
+			octaves := math.Log2(edges[1] / edges[0])
+			for i := 2; i < len(edges); i++ {
+				if got := math.Log2(edges[i] / edges[i-1]); math.Abs(got-octaves) > 1e-9 {
+					t.Errorf("%s: band %d spans %v octaves, band 0 %v", name, i-1, got, octaves)
+				}
+			}
+		}
+	}
+}
+
+func TestBandsDropNarrowBandsWithoutGaps(t *testing.T) {
+	spectrogram := DefaultSpectrogramConfig()
+	// 200 mel bands from 0 Hz make the lowest ones narrower than a bin.
+	config := PeakPickerConfig{Layout: BandLayoutMel, Bands: 200}
+	bands := config.bands(spectrogram)
+	if len(bands) >= config.Bands {
+		t.Fatalf("kept all %d bands, expected the narrowest to be dropped", len(bands))
+	}
+	if bands[0].min != 0 || bands[len(bands)-1].max != spectrogram.FrameSize/2 {
+		t.Errorf("bands cover bins %d-%d, want 0-%d", bands[0].min, bands[len(bands)-1].max, spectrogram.FrameSize/2)
+	}
+	for i, band := range bands {
+		if band.max <= band.min {
+			t.Errorf("band %d is empty: %+v", i, band)
+		}
+		if i > 0 && band.min != bands[i-1].max {
+			t.Errorf("gap or overlap between band %d %+v and %+v", i, bands[i-1], band)
+		}
+	}
+}
+
+func TestParseBandLayout(t *testing.T) {
+	for _, name := range []string{"edges", "mel", "log"} {
+		if layout, err := ParseBandLayout(name); err != nil || string(layout) != name {
+			t.Errorf("ParseBandLayout(%q) = %q, %v", name, layout, err)
+		}
+	}
+	if _, err := ParseBandLayout("bark"); err == nil {
+		t.Error("ParseBandLayout accepted bark")
+	}
+}
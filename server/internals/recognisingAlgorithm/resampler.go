@@ -0,0 +1,151 @@
+package recognisingalgorithm
+
+import (
+	"fmt"
+	"math"
+)
+
+// sincZeroCrossings is how many zero crossings of the low-pass sinc the
+// filter keeps on each side; more gives a sharper cutoff at a higher cost.
+const sincZeroCrossings = 16
+
+// Resampler converts a signal between two sample rates by the rational
+// factor up/down. Conceptually the input is upsampled by inserting zeros,
+// low-pass filtered and decimated; the polyphase form skips the zeros and
+// only computes the outputs that are kept, so any pair of rates (such as
+// 48000 to 11025) costs roughly one short filter per output sample.
+type Resampler struct {
+	up, down     int
+	tapsPerPhase int
+	delay        int         // Filter group delay at the upsampled rate
+	phases       [][]float64 // phases[p][j] is tap p + j*up of the prototype filter
+}
+
+// NewResampler designs a resampler from inRate to outRate. The low-pass
+// cutoff sits at the lower of the two Nyquist frequencies.
+func NewResampler(inRate, outRate int) (*Resampler, error) {
+	if inRate <= 0 || outRate <= 0 {
+		return nil, fmt.Errorf("sample rates must be positive, got %d and %d", inRate, outRate)
+	}
+	g := gcd(inRate, outRate)
+	up, down := outRate/g, inRate/g
+
+	cutoff := float64(min(inRate, outRate)) / 2
+	tapsPerPhase := 2 * int(math.Ceil(sincZeroCrossings*float64(inRate)/(2*cutoff)))
+	taps := tapsPerPhase * up
+	// Zero stuffing divides the signal energy by up, so the filter makes it up.
+	prototype := lowPassFIR(cutoff, float64(inRate*up), taps)
+
+	phases := make([][]float64, up)
+	for p := range phases {
+		phases[p] = make([]float64, tapsPerPhase)
+		for j := range phases[p] {
+			phases[p][j] = prototype[p+j*up] * float64(up)
+		}
+	}
+	return &Resampler{
+		up:           up,
+		down:         down,
+		tapsPerPhase: tapsPerPhase,
+		delay:        taps / 2,
+		phases:       phases,
+	}, nil
+}
+
+// Resample filters and resamples a whole signal. The filter delay is
+// compensated, so output sample m lines up with time m/outRate of the input.
+func (r *Resampler) Resample(input []float64) []float64 {
+	stream := r.stream()
+	output := stream.write(input, make([]float64, 0, (len(input)*r.up+r.down-1)/r.down))
+	return stream.flush(output)
+}
+
+// resamplerStream runs a Resampler over a signal that arrives in pieces. It
+// produces exactly the samples Resample would for the whole signal, holding
+// back only outputs whose filter still reaches past the input seen so far,
+// and keeps no more input than one filter length.
+type resamplerStream struct {
+	r        *Resampler
+	history  []float64 // Input samples from index base on
+	base     int
+	received int // Input samples seen so far
+	next     int // Index of the next output sample
+}
+
+func (r *Resampler) stream() *resamplerStream {
+	return &resamplerStream{r: r}
+}
+
+// write consumes input and appends every output that is now complete to out.
+func (s *resamplerStream) write(input, out []float64) []float64 {
+	s.history = append(s.history, input...)
+	s.received += len(input)
+	for {
+		// Position of this output on the upsampled time axis, shifted by
+		// the group delay so the filter is centred on it.
+		n := s.next*s.r.down + s.r.delay
+		if n/s.r.up >= s.received {
+			break
+		}
+		out = append(out, s.output(n))
+		s.next++
+	}
+
+	// Outputs from s.next on only reach back tapsPerPhase samples.
+	keep := (s.next*s.r.down+s.r.delay)/s.r.up - s.r.tapsPerPhase + 1
+	if drop := min(keep-s.base, len(s.history)); drop > 0 {
+		n := copy(s.history, s.history[drop:])
+		s.history = s.history[:n]
+		s.base += drop
+	}
+	return out
+}
+
+// flush appends the remaining outputs, treating the input as ended.
+func (s *resamplerStream) flush(out []float64) []float64 {
+	outLen := (s.received*s.r.up + s.r.down - 1) / s.r.down
+	for ; s.next < outLen; s.next++ {
+		out = append(out, s.output(s.next*s.r.down+s.r.delay))
+	}
+	return out
+}
+
+func (s *resamplerStream) output(n int) float64 {
+	phase := s.r.phases[n%s.r.up]
+	i := n / s.r.up
+	sum := 0.0
+	for j, coeff := range phase {
+		k := i - j
+		if k < s.base {
+			break
+		}
+		if k < s.received {
+			sum += coeff * s.history[k-s.base]
+		}
+	}
+	return sum
+}
+
+// Low-pass FIR filter generator (windowed sinc)
+func lowPassFIR(cutoff, sampleRate float64, taps int) []float64 {
+	h := make([]float64, taps)
+	normCutoff := cutoff / sampleRate // normalized cutoff (0..0.5)
+	for i := 0; i < taps; i++ {
+		m := float64(i - taps/2)
+		if m == 0 {
+			h[i] = 2 * normCutoff
+		} else {
+			h[i] = math.Sin(2*math.Pi*normCutoff*m) / (math.Pi * m)
+		}
+		// Hann window to reduce spectral leakage
+		h[i] *= 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/float64(taps-1)))
+	}
+	return h
+}
+
+func gcd(a, b int) int {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
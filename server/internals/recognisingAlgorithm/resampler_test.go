@@ -0,0 +1,68 @@
+package recognisingalgorithm
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestResampleMatchesStream(t *testing.T) {
+	for _, rates := range [][2]int{{44100, 11025}, {48000, 11025}, {22050, 11025}, {8000, 11025}} {
+		r, err := NewResampler(rates[0], rates[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+		input := randomSignal(20000, int64(rates[0]))
+		want := r.Resample(input)
+
+		rng := rand.New(rand.NewSource(1))
+		stream := r.stream()
+		var got []float64
+		for rest := input; len(rest) > 0; {
+			n := min(1+rng.Intn(700), len(rest))
+			got = stream.write(rest[:n], got)
+			rest = rest[n:]
+		}
+		got = stream.flush(got)
+
+		if len(got) != len(want) {
+			t.Fatalf("%d -> %d: stream gave %d samples, Resample %d", rates[0], rates[1], len(got), len(want))
+		}
+		for i := range want {
+			if math.Abs(got[i]-want[i]) > 1e-12 {
+				t.Fatalf("%d -> %d: sample %d = %v, want %v", rates[0], rates[1], i, got[i], want[i])
+			}
+		}
+	}
+}
+
+func TestResampleKeepsSine(t *testing.T) {
+	const (
+		freq      = 440.0
+		amplitude = 0.5
+		phase     = 0.7
+		outRate   = 11025
+	)
+	for _, inRate := range []int{44100, 48000} {
+		r, err := NewResampler(inRate, outRate)
+		if err != nil {
+			t.Fatal(err)
+		}
+		input := make([]float64, inRate)
+		for i := range input {
+			input[i] = amplitude * math.Sin(2*math.Pi*freq*float64(i)/float64(inRate)+phase)
+		}
+		output := r.Resample(input)
+
+		// Amplitude and phase must both survive; skip the edges, where the
+		// filter reaches past the signal.
+		maxErr := 0.0
+		for m := outRate / 10; m < len(output)-outRate/10; m++ {
+			want := amplitude * math.Sin(2*math.Pi*freq*float64(m)/outRate+phase)
+			maxErr = max(maxErr, math.Abs(output[m]-want))
+		}
+		if maxErr > 5e-4 {
+			t.Errorf("%d -> %d: output differs from the resampled sine by up to %v", inRate, outRate, maxErr)
+		}
+	}
+}
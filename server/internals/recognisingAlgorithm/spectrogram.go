@@ -4,29 +4,117 @@ import (
 	"errors"
 	"fmt"
 	"math"
-
-	"github.com/Pritam-deb/echo-sense/utils"
 )
 
+// WindowFunc names the window applied to each frame before the FFT.
+type WindowFunc string
+
 const (
-	DSPratio  = 4
-	frameSize = 1024 // this must be on power of 2 for FFT
-	hop       = frameSize / 32
+	WindowHann     WindowFunc = "hann"
+	WindowHamming  WindowFunc = "hamming"
+	WindowBlackman WindowFunc = "blackman"
 )
 
-func Spectrogram(sample []float64, sampleRate int) ([][]complex128, error) {
+// SpectrogramConfig describes how a signal is turned into a spectrogram.
+// Fingerprints are only comparable when they were computed with the same
+// config, so its Key is stored with every song.
+type SpectrogramConfig struct {
+	FrameSize        int        // Samples per FFT frame, must be a power of 2
+	Hop              int        // Samples between the starts of two frames
+	Window           WindowFunc // Window applied to every frame
+	TargetSampleRate int        // Every input is resampled to this rate, so bins mean the same frequency for any source
+}
+
+// DefaultSpectrogramConfig uses Hamming windowed frames of 1024 samples at
+// 11025 Hz, about 93 ms and 10.8 Hz per bin, started every 32 samples.
+func DefaultSpectrogramConfig() SpectrogramConfig {
+	return SpectrogramConfig{
+		FrameSize:        1024,
+		Hop:              1024 / 32,
+		Window:           WindowHamming,
+		TargetSampleRate: 11025,
+	}
+}
+
+// Validate reports whether the config can be used to compute a spectrogram.
+func (c SpectrogramConfig) Validate() error {
+	if c.FrameSize < 2 || c.FrameSize&(c.FrameSize-1) != 0 {
+		return fmt.Errorf("frame size must be a power of two, got %d", c.FrameSize)
+	}
+	// Peaks come from bins below the Nyquist bin FrameSize/2, which must all
+	// fit the frequency field of a hash.
+	if c.FrameSize/2 > 1<<maxFreqBits {
+		return fmt.Errorf("frame size %d has bins that do not fit %d hash bits, want at most %d", c.FrameSize, maxFreqBits, 2<<maxFreqBits)
+	}
+	if c.Hop < 1 {
+		return fmt.Errorf("hop must be positive, got %d", c.Hop)
+	}
+	if c.TargetSampleRate < 1 {
+		return fmt.Errorf("target sample rate must be positive, got %d", c.TargetSampleRate)
+	}
+	_, err := c.Window.coefficients(c.FrameSize)
+	return err
+}
+
+// Key identifies the config, e.g. "hamming-1024-32-11025".
+func (c SpectrogramConfig) Key() string {
+	return fmt.Sprintf("%s-%d-%d-%d", c.Window, c.FrameSize, c.Hop, c.TargetSampleRate)
+}
+
+// frameTime returns the start time in seconds of the frame at index, which
+// is the same for a whole spectrogram and for frames streamed one by one.
+func (c SpectrogramConfig) frameTime(index int) float64 {
+	return float64(index*c.Hop) / float64(c.TargetSampleRate)
+}
+
+// hzToBin returns the index of the FFT bin nearest to a frequency.
+func (c SpectrogramConfig) hzToBin(hz float64) int {
+	return int(math.Round(hz * float64(c.FrameSize) / float64(c.TargetSampleRate)))
+}
+
+// coefficients returns the window of length n.
+func (w WindowFunc) coefficients(n int) ([]float64, error) {
+	window := make([]float64, n)
+	for i := range window {
+		phase := 2 * math.Pi * float64(i) / float64(n-1)
+		switch w {
+		case WindowHann:
+			window[i] = 0.5 - 0.5*math.Cos(phase)
+		case WindowHamming:
+			window[i] = 0.54 - 0.46*math.Cos(phase)
+		case WindowBlackman:
+			window[i] = 0.42 - 0.5*math.Cos(phase) + 0.08*math.Cos(2*phase)
+		default:
+			return nil, fmt.Errorf("unknown window function %q", w)
+		}
+	}
+	return window, nil
+}
+
+// Spectrogram resamples the signal to config.TargetSampleRate and returns one
+// row per hop, each holding the FrameSize/2+1 bins from DC to the Nyquist
+// frequency.
+func Spectrogram(sample []float64, sampleRate int, config SpectrogramConfig) ([][]complex128, error) {
+	if err := config.Validate(); err != nil {
+		return nil, err
+	}
+	frameSize, hop := config.FrameSize, config.Hop
 	fmt.Printf("duration of the track is : %v\n", len(sample)/sampleRate)
 
 	// Downsample first
-	downSampled, err := DownSampleProper(sampleRate, sampleRate/DSPratio, sample)
-	fmt.Println("Len of downsampled singal: ", len(downSampled))
+	resampler, err := NewResampler(sampleRate, config.TargetSampleRate)
 	if err != nil {
-		return nil, errors.New("error downsampling the audio sample")
+		return nil, fmt.Errorf("error downsampling the audio sample: %w", err)
+	}
+	downSampled := resampler.Resample(sample)
+	fmt.Println("Len of downsampled singal: ", len(downSampled))
+	if len(downSampled) < frameSize {
+		return nil, errors.New("audio sample is too short for a single frame")
 	}
 
-	window := make([]float64, frameSize)
-	for i := range window {
-		window[i] = 0.54 - 0.46*math.Cos(2*math.Pi*float64(i)/float64(frameSize-1)) // Hamming
+	window, err := config.Window.coefficients(frameSize)
+	if err != nil {
+		return nil, err
 	}
 
 	// Number of frames
@@ -36,89 +124,32 @@ func Spectrogram(sample []float64, sampleRate int) ([][]complex128, error) {
 
 	// wave := make([]float64, frameSize)
 	// copy(wave, downSampled[320:320+frameSize])
-	// utils.PlotArrays("before hamming window", "downSample.png", wave)
+	// utils.PlotArrays("before window", "downSample.png", wave)
 	// for j := range wave {
 	// 	wave[j] *= window[j]
 	// }
-	// utils.PlotArrays("after hamming window", "downSample_afterHamming.png", wave)
+	// utils.PlotArrays("after window", "downSample_afterWindow.png", wave)
+
+	plan, err := NewRealFFTPlan(frameSize)
+	if err != nil {
+		return nil, err
+	}
+	frame := make([]float64, frameSize)
 
 	for i := 0; i < numFrames; i++ {
 		start := i * hop
-		frame := make([]float64, frameSize)
-		copy(frame, downSampled[start:start+frameSize])
 
 		// Apply window
 		for j := range frame {
-			frame[j] *= window[j]
+			frame[j] = downSampled[start+j] * window[j]
 		}
 
-		// FFT
-		spectrogram[i] = fftRealToComplex(frame)
+		// FFT, keeping only the non-redundant half of the spectrum
+		spectrogram[i] = make([]complex128, plan.Bins())
+		plan.Transform(frame, spectrogram[i])
 	}
 
 	fmt.Println("Spectrogram frames:", len(spectrogram))
 	fmt.Println("first value of spectrogram: ", spectrogram[0])
 	return spectrogram, nil
 }
-
-// Low-pass FIR filter generator (windowed sinc)
-func lowPassFIR(cutoff, sampleRate float64, taps int) []float64 {
-	h := make([]float64, taps)
-	normCutoff := cutoff / sampleRate // normalized cutoff (0..0.5)
-	k := make([]float64, taps)
-	for i := 0; i < taps; i++ {
-		m := float64(i - taps/2)
-		if m == 0 {
-			h[i] = 2 * normCutoff
-		} else {
-			h[i] = math.Sin(2*math.Pi*normCutoff*m) / (math.Pi * m)
-		}
-		// Hann window to reduce spectral leakage
-		k[i] = h[i] * 0.5 * (1 - math.Cos(2*math.Pi*float64(i)/float64(taps-1)))
-	}
-	utils.PlotArrays("FIR filter", "filter.png", k)
-
-	return k
-}
-
-// Convolve input with FIR filter
-func applyFIR(input, coeffs []float64) []float64 {
-	out := make([]float64, len(input))
-	for i := range input {
-		sum := 0.0
-		for j := range coeffs {
-			if i-j >= 0 {
-				sum += coeffs[j] * input[i-j]
-			}
-		}
-		out[i] = sum
-	}
-	// fmt.Println("First 64 filtered samples:", out[:64])
-	return out
-}
-
-// Proper downsampling
-func DownSampleProper(originalSampleRate, targetSampleRate int, input []float64) ([]float64, error) {
-	if targetSampleRate <= 0 || originalSampleRate <= 0 {
-		return nil, errors.New("sample rates must be positive")
-	}
-	if targetSampleRate > originalSampleRate {
-		return nil, errors.New("target sample rate must be <= original sample rate")
-	}
-
-	ratio := originalSampleRate / targetSampleRate
-	cutoff := float64(targetSampleRate) / 2 // Nyquist of target SR
-
-	// Design and apply low-pass filter
-	filter := lowPassFIR(cutoff, float64(originalSampleRate), 64)
-	filtered := applyFIR(input, filter)
-
-	// Decimate
-	output := make([]float64, 0, len(filtered)/ratio+1)
-	for i := 0; i < len(filtered); i += ratio {
-		output = append(output, filtered[i])
-	}
-	// fmt.Println("after down sampling length of the signal is ", len(output))
-	// fmt.Println("First 20 downsampled samples:", output[:20])
-	return output, nil
-}
@@ -0,0 +1,36 @@
+package recognisingalgorithm
+
+import "testing"
+
+func TestSpectrogramConfigValidateFrameSize(t *testing.T) {
+	for _, tc := range []struct {
+		frameSize int
+		valid     bool
+	}{
+		{512, true},
+		{1024, true},
+		{2048, false}, // Bins 512-1023 would wrap in the 9-bit hash field
+		{1000, false},
+	} {
+		config := DefaultSpectrogramConfig()
+		config.FrameSize = tc.frameSize
+		if err := config.Validate(); (err == nil) != tc.valid {
+			t.Errorf("FrameSize %d: Validate() = %v, want valid %v", tc.frameSize, err, tc.valid)
+		}
+	}
+}
+
+func TestBandsExcludeNyquistBin(t *testing.T) {
+	spectrogram := DefaultSpectrogramConfig()
+	nyquist := float64(spectrogram.TargetSampleRate) / 2
+	for _, peaks := range []PeakPickerConfig{
+		DefaultPeakPickerConfig(),
+		{Layout: BandLayoutEdges, BandEdges: []float64{0, 1000, nyquist}},
+		{Layout: BandLayoutMel, Bands: 8},
+	} {
+		bands := peaks.bands(spectrogram)
+		if last := bands[len(bands)-1]; last.max != spectrogram.FrameSize/2 {
+			t.Errorf("%s layout: last band ends at bin %d, want %d", peaks.Layout, last.max, spectrogram.FrameSize/2)
+		}
+	}
+}
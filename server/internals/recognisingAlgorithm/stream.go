@@ -0,0 +1,188 @@
+package recognisingalgorithm
+
+import (
+	"errors"
+	"io"
+
+	"github.com/Pritam-deb/echo-sense/pkg"
+)
+
+// streamBlockSize is the number of samples pulled from a SampleReader at a time.
+const streamBlockSize = 8192
+
+var errFlushed = errors.New("stream fingerprinter already flushed")
+
+// SampleReader is a source of mono samples normalised to [-1.0, 1.0], such
+// as a decoded WAV file. ReadSamples fills dst and returns the number of
+// samples read, and io.EOF once the source is exhausted.
+type SampleReader interface {
+	ReadSamples(dst []float64) (int, error)
+}
+
+// StreamFingerprinter fingerprints audio that arrives in pieces. Samples go
+// through a resampler, a framed FFT, the peak extractor and the fingerprinter
+// as they are written, and every fingerprint is handed to the emit callback
+// as soon as its target zone is complete. Only about one frame of audio and
+// the peaks of the last TargetZone.MaxTimeOffset seconds are held at any
+// time, so memory stays bounded however long the audio is; a time
+// neighbourhood in the peak picker holds back that many extra frames. Frame
+// times come from the hop, so no total duration is needed up front.
+type StreamFingerprinter struct {
+	config     SpectrogramConfig
+	sampleRate int
+	received   int // Input samples written so far
+
+	resampler *resamplerStream
+	window    []float64
+	plan      *RealFFTPlan
+	buffered  []float64 // Resampled samples from the start of the next frame on
+	skip      int       // Resampled samples still to drop when the hop exceeds the frame
+	frame     []float64
+	row       []complex128
+	frames    int // Frames transformed so far
+	picker    *peakPicker
+	peaks     []Peak
+
+	fingerprints *fingerprintStream
+	err          error
+}
+
+// NewStreamFingerprinter prepares a pipeline for mono audio at sampleRate.
+// Fingerprints carry songID and are passed to emit in anchor time order; an
+// error from emit stops the stream and is returned by Write or Flush.
+func NewStreamFingerprinter(sampleRate int, fingerprintConfig FingerprintConfig, songID string, emit func(pkg.Fingerprint) error) (*StreamFingerprinter, error) {
+	picker, err := newPeakPicker(fingerprintConfig)
+	if err != nil {
+		return nil, err
+	}
+	fingerprints, err := newFingerprintStream(songID, fingerprintConfig, emit)
+	if err != nil {
+		return nil, err
+	}
+	config := fingerprintConfig.Spectrogram
+	resampler, err := NewResampler(sampleRate, config.TargetSampleRate)
+	if err != nil {
+		return nil, err
+	}
+	window, err := config.Window.coefficients(config.FrameSize)
+	if err != nil {
+		return nil, err
+	}
+	plan, err := NewRealFFTPlan(config.FrameSize)
+	if err != nil {
+		return nil, err
+	}
+	return &StreamFingerprinter{
+		config:       config,
+		sampleRate:   sampleRate,
+		resampler:    resampler.stream(),
+		window:       window,
+		plan:         plan,
+		frame:        make([]float64, config.FrameSize),
+		row:          make([]complex128, plan.Bins()),
+		picker:       picker,
+		fingerprints: fingerprints,
+	}, nil
+}
+
+// Duration returns the seconds of audio written so far.
+func (s *StreamFingerprinter) Duration() float64 {
+	return float64(s.received) / float64(s.sampleRate)
+}
+
+// Write feeds the next samples of the signal through the pipeline.
+func (s *StreamFingerprinter) Write(samples []float64) error {
+	if s.err != nil {
+		return s.err
+	}
+	s.received += len(samples)
+	s.buffered = s.resampler.write(samples, s.buffered)
+	s.err = s.processFrames()
+	return s.err
+}
+
+// Flush marks the end of the signal and emits the remaining fingerprints.
+// The stream cannot be written to afterwards.
+func (s *StreamFingerprinter) Flush() error {
+	if s.err != nil {
+		return s.err
+	}
+	s.buffered = s.resampler.flush(s.buffered)
+	if s.err = s.processFrames(); s.err != nil {
+		return s.err
+	}
+	s.peaks = s.picker.flush(s.peaks[:0])
+	sortPeaks(s.peaks)
+	if s.err = s.fingerprints.add(s.peaks); s.err != nil {
+		return s.err
+	}
+	if s.err = s.fingerprints.flush(); s.err != nil {
+		return s.err
+	}
+	s.err = errFlushed
+	return nil
+}
+
+// processFrames transforms every complete frame in the buffer, extracts its
+// peaks and passes them on, then drops the samples no later frame needs.
+func (s *StreamFingerprinter) processFrames() error {
+	frameSize, hop := s.config.FrameSize, s.config.Hop
+	if s.skip > 0 {
+		drop := min(s.skip, len(s.buffered))
+		s.buffered = s.buffered[drop:]
+		s.skip -= drop
+	}
+
+	start := 0
+	for ; start+frameSize <= len(s.buffered); start += hop {
+		for j := range s.frame {
+			s.frame[j] = s.buffered[start+j] * s.window[j]
+		}
+		s.plan.Transform(s.frame, s.row)
+
+		s.peaks = s.picker.add(s.row, s.config.frameTime(s.frames), s.peaks[:0])
+		sortPeaks(s.peaks)
+		s.frames++
+		if err := s.fingerprints.add(s.peaks); err != nil {
+			return err
+		}
+	}
+
+	if start >= len(s.buffered) {
+		s.skip = start - len(s.buffered)
+		s.buffered = s.buffered[:0]
+		return nil
+	}
+	n := copy(s.buffered, s.buffered[start:])
+	s.buffered = s.buffered[:n]
+	return nil
+}
+
+// FingerprintReader reads mono audio at sampleRate from r until io.EOF and
+// streams its fingerprints to emit. It returns the duration of the audio in
+// seconds.
+func FingerprintReader(r SampleReader, sampleRate int, config FingerprintConfig, songID string, emit func(pkg.Fingerprint) error) (float64, error) {
+	stream, err := NewStreamFingerprinter(sampleRate, config, songID, emit)
+	if err != nil {
+		return 0, err
+	}
+	block := make([]float64, streamBlockSize)
+	for {
+		n, err := r.ReadSamples(block)
+		if n > 0 {
+			if err := stream.Write(block[:n]); err != nil {
+				return 0, err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+	if err := stream.Flush(); err != nil {
+		return 0, err
+	}
+	return stream.Duration(), nil
+}
@@ -0,0 +1,80 @@
+package recognisingalgorithm
+
+import (
+	"io"
+	"math"
+	"math/rand"
+	"slices"
+	"testing"
+
+	"github.com/Pritam-deb/echo-sense/pkg"
+)
+
+// sliceReader is a SampleReader over samples held in memory.
+type sliceReader struct{ samples []float64 }
+
+func (r *sliceReader) ReadSamples(dst []float64) (int, error) {
+	if len(r.samples) == 0 {
+		return 0, io.EOF
+	}
+	n := copy(dst, r.samples)
+	r.samples = r.samples[n:]
+	return n, nil
+}
+
+// testSignal is a few seconds of two gliding tones over noise.
+func testSignal(sampleRate int, seconds float64) []float64 {
+	rng := rand.New(rand.NewSource(1))
+	samples := make([]float64, int(float64(sampleRate)*seconds))
+	for i := range samples {
+		t := float64(i) / float64(sampleRate)
+		samples[i] = 0.3*math.Sin(2*math.Pi*(220+50*math.Sin(t))*t) +
+			0.2*math.Sin(2*math.Pi*1300*t*(1+0.1*math.Sin(3*t))) +
+			0.1*rng.NormFloat64()
+	}
+	return samples
+}
+
+func compareFingerprints(a, b pkg.Fingerprint) int {
+	if a.AnchorTime != b.AnchorTime {
+		return int(a.AnchorTime) - int(b.AnchorTime)
+	}
+	return int(a.Hash) - int(b.Hash)
+}
+
+func TestFingerprintReaderMatchesBatch(t *testing.T) {
+	samples := testSignal(44100, 5)
+	for _, strategy := range []PeakStrategy{PeakStrategyBand, PeakStrategyMaxFilter} {
+		config := DefaultFingerprintConfig()
+		config.Peaks.Strategy = strategy
+		config.Peaks.TimeNeighbourhood = 2
+
+		spectrogram, err := Spectrogram(samples, 44100, config.Spectrogram)
+		if err != nil {
+			t.Fatal(err)
+		}
+		peaks, err := ExtractPeaks(spectrogram, config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := Fingerprint(peaks, "song", config)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		var got []pkg.Fingerprint
+		_, err = FingerprintReader(&sliceReader{samples}, 44100, config, "song", func(fp pkg.Fingerprint) error {
+			got = append(got, fp)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		slices.SortFunc(want, compareFingerprints)
+		slices.SortFunc(got, compareFingerprints)
+		if len(want) == 0 || !slices.Equal(got, want) {
+			t.Errorf("%s: stream gave %d fingerprints, batch %d, or they differ", strategy, len(got), len(want))
+		}
+	}
+}
@@ -0,0 +1,240 @@
+package songservice
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/Pritam-deb/echo-sense/db"
+	"github.com/Pritam-deb/echo-sense/db/models"
+	recognisingalgorithm "github.com/Pritam-deb/echo-sense/internals/recognisingAlgorithm"
+	wavservice "github.com/Pritam-deb/echo-sense/internals/wavService"
+	"github.com/Pritam-deb/echo-sense/pkg"
+	"github.com/Pritam-deb/echo-sense/utils"
+	"github.com/google/uuid"
+)
+
+// SongInfo describes a song being added to the library.
+type SongInfo struct {
+	Title, Artist, Album string
+	YoutubeID            string
+}
+
+// FingerprintAudio decodes an audio file with wavservice.OpenAudio and
+// streams it through the fingerprinting pipeline with the given config,
+// passing each fingerprint to emit as it is produced and returning
+// the duration in seconds. The file is left in place for the caller.
+func FingerprintAudio(audioFilePath, songID string, config recognisingalgorithm.FingerprintConfig, emit func(pkg.Fingerprint) error) (float64, error) {
+	logger := utils.GetLogger()
+
+	decoder, err := wavservice.OpenAudio(audioFilePath)
+	if err != nil {
+		logger.Error("Failed to open audio", "error", err, "audioFilePath", audioFilePath)
+		return 0, err
+	}
+	defer decoder.Close()
+
+	duration, err := fingerprintDecoder(decoder, songID, config, emit)
+	if err != nil {
+		logger.Error("Failed to fingerprint audio", "error", err, "audioFilePath", audioFilePath)
+		return 0, err
+	}
+	return duration, nil
+}
+
+// fingerprintDecoder mixes the decoded audio down to mono and streams it
+// through the fingerprinting pipeline.
+func fingerprintDecoder(decoder wavservice.AudioDecoder, songID string, config recognisingalgorithm.FingerprintConfig, emit func(pkg.Fingerprint) error) (float64, error) {
+	reader := wavservice.NewMonoReader(decoder, DownmixFromEnv())
+	duration, err := recognisingalgorithm.FingerprintReader(reader, decoder.SampleRate(), config, songID, emit)
+	if err != nil {
+		return 0, fmt.Errorf("Failed to fingerprint audio: %v", err)
+	}
+	return duration, nil
+}
+
+// DownmixFromEnv returns the downmix named by the DOWNMIX environment
+// variable, defaulting to the average of all channels. Ingestion and search
+// both use it, so songs and clips are reduced to mono the same way.
+func DownmixFromEnv() wavservice.Downmix {
+	downmix, err := wavservice.ParseDownmix(utils.GetEnv("DOWNMIX", string(wavservice.DownmixAverage)))
+	if err != nil {
+		utils.GetLogger().Warn("Ignoring DOWNMIX", "error", err)
+		return wavservice.DownmixAverage
+	}
+	return downmix
+}
+
+// FingerprintConfigFromEnv returns the default fingerprint config with the
+// peak picking set by the environment: PEAK_STRATEGY names the strategy,
+// band by default, PEAK_TIME_NEIGHBOURHOOD the frames either side a peak
+// must beat, 0 by default, and BAND_LAYOUT and BANDS how the spectrum is
+// split, edges by default. Only the spectrogram config has to match between
+// songs and clips, so these may change without reindexing.
+func FingerprintConfigFromEnv() recognisingalgorithm.FingerprintConfig {
+	logger := utils.GetLogger()
+	config := recognisingalgorithm.DefaultFingerprintConfig()
+	strategy, err := recognisingalgorithm.ParsePeakStrategy(utils.GetEnv("PEAK_STRATEGY", string(config.Peaks.Strategy)))
+	if err != nil {
+		logger.Warn("Ignoring PEAK_STRATEGY", "error", err)
+	} else {
+		config.Peaks.Strategy = strategy
+	}
+	if value := utils.GetEnv("PEAK_TIME_NEIGHBOURHOOD", ""); value != "" {
+		frames, err := strconv.Atoi(value)
+		if err != nil || frames < 0 {
+			logger.Warn("Ignoring PEAK_TIME_NEIGHBOURHOOD, expected a non-negative number of frames", "value", value)
+		} else {
+			config.Peaks.TimeNeighbourhood = frames
+		}
+	}
+	layout, err := recognisingalgorithm.ParseBandLayout(utils.GetEnv("BAND_LAYOUT", string(config.Peaks.Layout)))
+	if err != nil {
+		logger.Warn("Ignoring BAND_LAYOUT", "error", err)
+	} else {
+		config.Peaks.Layout = layout
+	}
+	if value := utils.GetEnv("BANDS", ""); value != "" {
+		bands, err := strconv.Atoi(value)
+		if err != nil || bands < 1 {
+			logger.Warn("Ignoring BANDS, expected a positive number of bands", "value", value)
+		} else {
+			config.Peaks.Bands = bands
+		}
+	}
+	return config
+}
+
+// ErrNoAudio is returned when a song's audio decodes to nothing, as happens
+// when a download stream is cut off before any data arrives.
+var ErrNoAudio = errors.New("audio stream contained no samples")
+
+// SaveSong fingerprints an audio file and stores it together with its
+// fingerprints and the key of the spectrogram config they were computed with.
+// Fingerprints are written to the database as they are produced, so long
+// recordings are never held in memory.
+func SaveSong(audioFilePath string, info SongInfo, config recognisingalgorithm.FingerprintConfig) (*models.Song, error) {
+	return saveSong(info, config, func(songID string, emit func(pkg.Fingerprint) error) (float64, error) {
+		return FingerprintAudio(audioFilePath, songID, config, emit)
+	})
+}
+
+// SaveSongFromStream is SaveSong for audio read from a stream, in any
+// format ffmpeg understands, such as a download in progress. The stream is
+// piped through ffmpeg straight into the fingerprinter, so nothing is written
+// to disk. It returns ErrNoAudio, and saves nothing, when the stream holds no
+// audio. The caller closes audio.
+func SaveSongFromStream(audio io.Reader, info SongInfo, config recognisingalgorithm.FingerprintConfig) (*models.Song, error) {
+	return saveSong(info, config, fingerprintStream(audio, config))
+}
+
+// ReindexSongFromStream regenerates the fingerprints of a stored song from
+// its audio, read from a stream as by SaveSongFromStream, and replaces the
+// old ones along with the song's config key and hash version. The song keeps
+// its old fingerprints if anything fails.
+func ReindexSongFromStream(song *models.Song, audio io.Reader, config recognisingalgorithm.FingerprintConfig) error {
+	logger := utils.GetLogger()
+	count, err := storeFingerprints(song, config, fingerprintStream(audio, config), db.ReplaceSongFingerprints)
+	if err != nil {
+		logger.Error("Failed to replace fingerprints in DB", "error", err, "title", song.Title)
+		return err
+	}
+	logger.Info("Song reindexed", "title", song.Title, "artist", song.Artist, "fingerprints", count)
+	return nil
+}
+
+// fingerprintStream returns a fingerprint function for saveSong that pipes
+// audio through ffmpeg into the pipeline and fails with ErrNoAudio when it holds no samples.
+func fingerprintStream(audio io.Reader, config recognisingalgorithm.FingerprintConfig) func(songID string, emit func(pkg.Fingerprint) error) (float64, error) {
+	return func(songID string, emit func(pkg.Fingerprint) error) (float64, error) {
+		decoder, err := wavservice.NewFFmpegStreamDecoder(audio)
+		if err != nil {
+			return 0, err
+		}
+		defer decoder.Close()
+		duration, err := fingerprintDecoder(decoder, songID, config, emit)
+		if err == nil && duration == 0 {
+			err = ErrNoAudio
+		}
+		return duration, err
+	}
+}
+
+// saveSong stores a song and the fingerprints fingerprint emits for it in one
+// transaction.
+func saveSong(info SongInfo, config recognisingalgorithm.FingerprintConfig, fingerprint func(songID string, emit func(pkg.Fingerprint) error) (float64, error)) (*models.Song, error) {
+	logger := utils.GetLogger()
+	song := models.Song{
+		ID:        uuid.New(),
+		Title:     info.Title,
+		Artist:    info.Artist,
+		Album:     info.Album,
+		YoutubeID: info.YoutubeID,
+		SongKey:   utils.GenerateSongKey(info.Artist, info.Title),
+	}
+
+	count, err := storeFingerprints(&song, config, fingerprint, db.SaveSongWithFingerprints)
+	if err != nil {
+		logger.Error("Failed to save song and fingerprints to DB", "error", err, "title", info.Title)
+		return nil, err
+	}
+	if count == 0 {
+		logger.Warn("No fingerprints generated for song", "title", info.Title)
+	}
+	logger.Info("Song saved to DB", "title", info.Title, "artist", info.Artist, "fingerprints", count)
+	return &song, nil
+}
+
+// storeFingerprints runs fingerprint for song and writes its output with
+// store, marking the song with the config key and hash version used. It
+// returns the number of fingerprints written.
+func storeFingerprints(song *models.Song, config recognisingalgorithm.FingerprintConfig, fingerprint func(songID string, emit func(pkg.Fingerprint) error) (float64, error), store func(*models.Song, func(insert func(models.AudioFingerprint) error) error) error) (int, error) {
+	song.SpectrogramConfig = config.Spectrogram.Key()
+	song.HashVersion = recognisingalgorithm.HashVersion
+
+	count := 0
+	err := store(song, func(insert func(models.AudioFingerprint) error) error {
+		duration, err := fingerprint(song.ID.String(), func(fp pkg.Fingerprint) error {
+			count++
+			return insert(models.AudioFingerprint{
+				Hash:       int64(fp.Hash),
+				AnchorTime: float64(fp.AnchorTime) / 1000,
+			})
+		})
+		song.Duration = int(duration)
+		return err
+	})
+	return count, err
+}
+
+// InfoFromFile works out a song's title, artist and album from the tags
+// embedded in the file, falling back to an "Artist - Title" file name.
+func InfoFromFile(audioFilePath string) SongInfo {
+	var info SongInfo
+	tags, err := wavservice.ReadTags(audioFilePath)
+	if err != nil {
+		utils.GetLogger().Warn("Failed to read tags", "error", err, "audioFilePath", audioFilePath)
+	}
+	info.Title = strings.TrimSpace(tags["title"])
+	info.Artist = strings.TrimSpace(tags["artist"])
+	info.Album = strings.TrimSpace(tags["album"])
+
+	name := strings.TrimSuffix(filepath.Base(audioFilePath), filepath.Ext(audioFilePath))
+	nameArtist, nameTitle, found := strings.Cut(name, " - ")
+	if !found {
+		nameArtist, nameTitle = "", name
+	}
+	if info.Title == "" {
+		info.Title = strings.TrimSpace(nameTitle)
+	}
+	if info.Artist == "" {
+		info.Artist = strings.TrimSpace(nameArtist)
+	}
+	if info.Artist == "" {
+		info.Artist = "Unknown Artist"
+	}
+	return info
+}
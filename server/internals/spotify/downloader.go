@@ -2,234 +2,226 @@ package spotify
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"io"
 	"log/slog"
-	"os"
-	"path/filepath"
 	"runtime"
 	"sync"
 
 	"github.com/Pritam-deb/echo-sense/db"
 	"github.com/Pritam-deb/echo-sense/db/models"
-	recognisingalgorithm "github.com/Pritam-deb/echo-sense/internals/recognisingAlgorithm"
-	wavservice "github.com/Pritam-deb/echo-sense/internals/wavService"
+	songservice "github.com/Pritam-deb/echo-sense/internals/songService"
 	"github.com/Pritam-deb/echo-sense/utils"
 	"github.com/kkdai/youtube/v2"
 )
 
-var wg sync.WaitGroup
+// DownloadSummary counts what happened to each track of a download.
+type DownloadSummary struct {
+	Downloaded int
+	Skipped    int // Already in the library
+	Failed     int
+}
+
+type downloadResult int
+
+const (
+	trackDownloaded downloadResult = iota
+	trackSkipped
+	trackFailed
+)
 
-func DownloadSingleTrack(url string, downloadPath string) {
+func DownloadSingleTrack(url string) {
 	logger := utils.GetLogger()
-	logger.Info("Starting download for single track", "url", url, "path", downloadPath)
+	logger.Info("Starting download for single track", "url", url)
 	track, err := GetTrackInfo(url)
 	if err != nil {
 		logger.Error("Failed to get track info", "error", err)
 		return
 	}
 	logger.Info("Track info retrieved", "track", track)
-	tracks := []Track{*track}
-	count, err := TracksDownloader(tracks, downloadPath)
+	downloadTracks([]Track{*track})
+}
+
+func DownloadAlbum(url string) {
+	logger := utils.GetLogger()
+	logger.Info("Starting download for album", "url", url)
+	tracks, err := GetAlbumInfo(url)
 	if err != nil {
-		logger.Error("Failed to download track", "error", err)
+		logger.Error("Failed to get album info", "error", err)
 		return
 	}
-	logger.Info("Download completed", "count", count)
+	logger.Info("Album info retrieved", "tracks", len(tracks))
+	downloadTracks(tracks)
 }
 
-func TracksDownloader(tracks []Track, downloadPath string) (int, error) {
-	var downloadedCount int
-	// var downloadedTracks []string
+func DownloadPlaylist(url string) {
+	logger := utils.GetLogger()
+	logger.Info("Starting download for playlist", "url", url)
+	tracks, err := GetPlaylistInfo(url)
+	if err != nil {
+		logger.Error("Failed to get playlist info", "error", err)
+		return
+	}
+	logger.Info("Playlist info retrieved", "tracks", len(tracks))
+	downloadTracks(tracks)
+}
+
+func downloadTracks(tracks []Track) {
+	logger := utils.GetLogger()
+	summary, err := TracksDownloader(tracks)
+	if err != nil {
+		logger.Error("Failed to download tracks", "error", err)
+		return
+	}
+	logger.Info("Download completed", "downloaded", summary.Downloaded, "skipped", summary.Skipped, "failed", summary.Failed)
+	fmt.Printf("Downloaded %d, skipped %d, failed %d of %d tracks\n", summary.Downloaded, summary.Skipped, summary.Failed, len(tracks))
+}
+
+// TracksDownloader streams every track from YouTube into the library, a few
+// at a time, and counts the outcomes.
+func TracksDownloader(tracks []Track) (DownloadSummary, error) {
+	var summary DownloadSummary
+	var wg sync.WaitGroup
 
 	noCPUs := runtime.NumCPU()
 	sem := make(chan struct{}, noCPUs)
-	logger := utils.GetLogger()
-	results := make(chan int, len(tracks))
-	ctx := context.Background()
+	results := make(chan downloadResult, len(tracks))
 
 	for _, track := range tracks {
-
 		wg.Add(1)
 		go func(track Track) {
 			defer wg.Done()
 			sem <- struct{}{}
 			defer func() { <-sem }()
-			trackInfo := track.buildTrack()
-			//get YT id of the track
-			ytID, err := getYoutubeID(*trackInfo)
-			if err != nil {
-				logger.ErrorContext(ctx, "Failed to get YT ID", slog.Any("error", err), slog.Any("track", trackInfo))
-				results <- 0
-				return
-			}
-			//download the track from yt
-			trackInfo.Title, trackInfo.Artist = changeFileName(trackInfo.Title, trackInfo.Artist)
-			fileName := fmt.Sprintf("%s - %s", trackInfo.Artist, trackInfo.Title)
-			filePath := filepath.Join(downloadPath, fileName+".m4a")
-			err = downloadAudioFromYT(ytID, downloadPath, filePath)
-			if err != nil {
-				logger.ErrorContext(ctx, "Failed to download audio from YT", slog.Any("error", err), slog.Any("ytID", ytID), slog.Any("filePath", filePath))
-				results <- 0
-				return
-			}
-			err = processAndSaveTrack(filePath, trackInfo.Title, trackInfo.Artist, track.Album, ytID)
+			results <- downloadTrack(track)
 		}(track)
 	}
 	wg.Wait()
 	close(results)
-	return downloadedCount, nil
-}
 
-func processAndSaveTrack(audioFilePath, songTitle, songArtist, songAlbum, ytID string) error {
+	for result := range results {
+		switch result {
+		case trackDownloaded:
+			summary.Downloaded++
+		case trackSkipped:
+			summary.Skipped++
+		case trackFailed:
+			summary.Failed++
+		}
+	}
+	return summary, nil
+}
 
+func downloadTrack(track Track) downloadResult {
 	logger := utils.GetLogger()
-	wavFilePath, err := wavservice.ConvertToWav(audioFilePath, 1)
+	ctx := context.Background()
+	trackInfo := track.buildTrack()
+	trackInfo.Title, trackInfo.Artist = changeFileName(trackInfo.Title, trackInfo.Artist)
+
+	existing, err := db.FindSongs("song_key", utils.GenerateSongKey(trackInfo.Artist, trackInfo.Title))
 	if err != nil {
-		logger.Error("Failed to convert to WAV", "error", err, "audioFilePath", audioFilePath)
-		return err
+		logger.ErrorContext(ctx, "Failed to check library for track", slog.Any("error", err), slog.Any("track", trackInfo))
+		return trackFailed
 	}
-	// fmt.Println("Converted to WAV:", wavFilePath)
-	wavInfo, err := wavservice.ReadWavFile(wavFilePath)
-	if err != nil {
-		logger.Error("Failed to read WAV file", "error", err, "wavFilePath", wavFilePath)
+	if len(existing) > 0 {
+		logger.InfoContext(ctx, "Track already in library, skipping", slog.Any("track", trackInfo))
+		return trackSkipped
 	}
-	fmt.Println("wav duration:", wavInfo.Duration, "seconds")
 
-	samples, err := wavservice.ConvertWavDataToSamples(wavInfo.Data)
+	//get YT id of the track
+	ytID, err := getYoutubeID(track)
 	if err != nil {
-		logger.Error("Failed to convert WAV data to samples", "error", err, "wavFilePath", wavFilePath)
-		return fmt.Errorf("Failed to convert WAV data to samples: %v", err)
+		logger.ErrorContext(ctx, "Failed to get YT ID", slog.Any("error", err), slog.Any("track", trackInfo))
+		return trackFailed
 	}
-	fmt.Println("Number of samples:", len(samples))
-	// fmt.Println("First 64 samples:", samples[:64])
-	spectrogram, err := recognisingalgorithm.Spectrogram(samples, int(wavInfo.SampleRate))
-	if err != nil {
-		logger.Error("Failed to compute spectrogram", "error", err, "wavFilePath", wavFilePath)
-		return fmt.Errorf("Failed to compute spectrogram: %v", err)
-	}
-	// fmt.Println("Spectrogram computed with", len(spectrogram), "time frames")
-	// //to view the spectrogram image, uncomment the lines below
-	// err = utils.SaveSpectrogramImage(spectrogram, int(wavInfo.SampleRate), fmt.Sprintf("%s_spectrogram.png", songTitle))
-	// const (
-	// 	DSPratio    = 4
-	// 	freqBinSize = 1024
-	// 	hopSize     = freqBinSize / 32
-	// )
-	// utils.SaveSpectrogramWithLabels(spectrogram, fmt.Sprintf("%s_spectrogram.png", songTitle), int(wavInfo.SampleRate), hopSize, wavInfo.Duration, true)
-	// utils.VerifySpectrogramCompleteness(spectrogram, samples, int(wavInfo.SampleRate), hopSize)
-	// if err != nil {
-	// 	logger.Error("Failed to save spectrogram image", "error", err, "ytID", ytID)
-	// 	return fmt.Errorf("Failed to save spectrogram image: %v", err)
-	// }
-
-	song := models.Song{
-		Title:     songTitle,
-		Artist:    songArtist,
-		Album:     songAlbum,
-		YoutubeID: ytID,
-		SongKey:   utils.GenerateSongKey(songArtist, songTitle),
-		Duration:  int(wavInfo.Duration),
+	if ytID == "" {
+		logger.ErrorContext(ctx, "No YouTube video matches the track duration", slog.Any("track", trackInfo))
+		return trackFailed
 	}
-
-	if err := db.DB.Create(&song).Error; err != nil {
-		logger.Error("Failed to save song to DB", "error", err)
-		return err
+	info := songservice.SongInfo{
+		Title:     trackInfo.Title,
+		Artist:    trackInfo.Artist,
+		Album:     trackInfo.Album,
+		YoutubeID: ytID,
 	}
-	logger.Info("Song saved to DB", "youtube_id", ytID)
-	peaks := recognisingalgorithm.ExtractPeaks(spectrogram, wavInfo.Duration)
-	fingerprints := recognisingalgorithm.Fingerprint(peaks, song.ID.String())
-
-	// peaks := recognisingalgorithm.ExtractPeaks(spectrogram, wavInfo.Duration, int(wavInfo.SampleRate))
-	// pairs := recognisingalgorithm.BuildConstellationMap(peaks, 3.0)
-	// fingerprints := recognisingalgorithm.GenerateFingerprints(pairs)
-	fmt.Println("Generated", len(fingerprints), "fingerprints")
-	// var audioFingerprints []models.AudioFingerprint
-	// for address, fp := range fingerprints {
-	// 	audioFingerprints = append(audioFingerprints, models.AudioFingerprint{
-	// 		Address:    int(address),
-	// 		AnchorTime: int(fp.AnchorTime),
-	// 		SongID:     song.ID,
-	// 	})
-	// }
-
-	// if len(audioFingerprints) > 0 {
-	// 	batchSize := 1000
-	// 	for i := 0; i < len(audioFingerprints); i += batchSize {
-	// 		end := i + batchSize
-	// 		if end > len(audioFingerprints) {
-	// 			end = len(audioFingerprints)
-	// 		}
-	// 		if err := db.DB.Create(audioFingerprints[i:end]).Error; err != nil {
-	// 			logger.Error("Failed to save batch of fingerprints", "error", err)
-	// 			return err
-	// 		}
-	// 	}
-	// } else {
-	// 	fmt.Println("No fingerprints generated for song:", songTitle)
-	// }
-
-	// clean up temp files
-	err = os.Remove(audioFilePath)
+	// The audio is piped from YouTube straight into the fingerprinter.
+	err = retryEmptyStream(ytID, func() error { return saveFromYT(ytID, info) })
 	if err != nil {
-		logger.Warn("Failed to remove audio file", "error", err, "audioFilePath", audioFilePath)
+		logger.ErrorContext(ctx, "Failed to save track", slog.Any("error", err), slog.Any("ytID", ytID), slog.Any("track", trackInfo))
+		return trackFailed
 	}
-	err = os.Remove(wavFilePath)
-	if err != nil {
-		logger.Warn("Failed to remove WAV file", "error", err, "wavFilePath", wavFilePath)
+	return trackDownloaded
+}
+
+// ReindexSong regenerates a stored song's fingerprints with the current
+// fingerprint config and hash layout by streaming its audio from YouTube
+// again. Songs added from local files have no YouTube ID and must be saved
+// again instead.
+func ReindexSong(song *models.Song) error {
+	if song.YoutubeID == "" {
+		return ErrNoYoutubeID
 	}
-	return nil
+	return retryEmptyStream(song.YoutubeID, func() error {
+		stream, err := openYTStream(song.YoutubeID)
+		if err != nil {
+			return err
+		}
+		defer stream.Close()
+		return songservice.ReindexSongFromStream(song, stream, songservice.FingerprintConfigFromEnv())
+	})
 }
 
-func downloadAudioFromYT(id, path, filepath string) error {
-	fmt.Println("Downloading to:", filepath, " in directory:", path)
-	logger := utils.GetLogger()
-	dir, err := os.Stat(path)
-	if err != nil {
-		logger.Error("Failed to get directory info", "error", err, "path", path)
-		return err
+// ErrNoYoutubeID is returned by ReindexSong for songs that were not
+// downloaded from YouTube.
+var ErrNoYoutubeID = errors.New("song has no YouTube ID to stream its audio from")
+
+// maxStreamAttempts is how often an empty YouTube stream is requested again.
+const maxStreamAttempts = 3
+
+// retryEmptyStream runs save, which streams the YouTube video id, again when
+// the stream ends before any audio arrives.
+func retryEmptyStream(id string, save func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := save()
+		if !errors.Is(err, songservice.ErrNoAudio) || attempt == maxStreamAttempts {
+			return err
+		}
+		utils.GetLogger().Warn("YouTube stream was empty, retrying", "ytID", id, "attempt", attempt)
 	}
+}
 
-	if !dir.IsDir() {
-		err := fmt.Errorf("provided path is not a directory: %s", path)
-		logger.Error("Invalid directory path", "error", err, "path", path)
+// saveFromYT streams the audio of a YouTube video into the library.
+func saveFromYT(id string, info songservice.SongInfo) error {
+	stream, err := openYTStream(id)
+	if err != nil {
 		return err
 	}
+	defer stream.Close()
+	_, err = songservice.SaveSongFromStream(stream, info, songservice.FingerprintConfigFromEnv())
+	return err
+}
+
+// openYTStream opens the m4a audio of a YouTube video.
+func openYTStream(id string) (io.ReadCloser, error) {
+	logger := utils.GetLogger()
 	youtubeClient := youtube.Client{}
 	video, err := youtubeClient.GetVideo(id)
 	if err != nil {
 		logger.Error("Failed to get YouTube video", "error", err, "id", id)
-		return err
+		return nil, err
 	}
 
 	formats := video.Formats.Itag(140) // m4a format
 	if len(formats) == 0 {
 		err := fmt.Errorf("no suitable format found for video ID: %s", id)
 		logger.Error("No suitable format", "error", err, "id", id)
-		return err
+		return nil, err
 	}
-	file, err := os.Create(filepath)
+	stream, _, err := youtubeClient.GetStream(video, &formats[0])
 	if err != nil {
-		logger.Error("Failed to create file", "error", err, "filepath", filepath)
-		return err
-	}
-	var fileSize int64
-	//to make sure file size is not 0 and file is completely written
-	//try not to use busy wait here
-	for fileSize == 0 {
-		stream, _, err := youtubeClient.GetStream(video, &formats[0])
-		if err != nil {
-			logger.Error("Failed to get video stream", "error", err, "id", id)
-			file.Close()
-			return err
-		}
-		if _, err = io.Copy(file, stream); err != nil {
-			logger.Error("Failed to copy stream to file", "error", err, "filepath", filepath)
-			file.Close()
-			return err
-		}
-		fileSize, _ = GetFileSize(filepath)
+		logger.Error("Failed to get video stream", "error", err, "id", id)
+		return nil, err
 	}
-	defer file.Close()
-	return nil
+	return stream, nil
 }
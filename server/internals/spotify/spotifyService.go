@@ -52,55 +52,164 @@ func hitSpotifyEndpoints(endpoint string) (int, string, error) {
 	return resp.StatusCode, string(body), nil
 }
 
-func GetTrackInfo(url string) (*Track, error) {
-	// example url: https://open.spotify.com/track/2VOnMNQWQ44OqHWwvXn5z6\?si\=7f6007e3a57a4706
-	baseUrl := "https://api.spotify.com/v1/tracks/"
-	pattern := `^(?:https?:\/\/)?open\.spotify\.com\/track\/([A-Za-z0-9]{22})(?:\?.*)?$`
+// spotifyID extracts the 22 character ID from an open.spotify.com URL of the
+// given kind ("track", "album" or "playlist").
+func spotifyID(url, kind string) (string, error) {
+	pattern := `^(?:https?:\/\/)?open\.spotify\.com\/` + kind + `\/([A-Za-z0-9]{22})(?:\?.*)?$`
 	re := regexp.MustCompile(pattern)
 	matches := re.FindStringSubmatch(url)
-	var trackID string
-	if len(matches) > 1 {
-		trackID = matches[1]
-	} else {
-		fmt.Println("No match found")
+	if len(matches) < 2 {
+		return "", fmt.Errorf("not a spotify %s url: %s", kind, url)
+	}
+	return matches[1], nil
+}
+
+// URLKind returns "track", "album" or "playlist" for an open.spotify.com URL
+// of that kind, judged by its path, or "" for any other URL.
+func URLKind(url string) string {
+	for _, kind := range []string{"track", "album", "playlist"} {
+		if _, err := spotifyID(url, kind); err == nil {
+			return kind
+		}
 	}
-	endpoint := baseUrl + trackID
+	return ""
+}
+
+type spotifyArtist struct {
+	Name string `json:"name"`
+}
+
+type spotifyTrack struct {
+	Name  string `json:"name"`
+	Album struct {
+		Name        string `json:"name"`
+		ReleaseDate string `json:"release_date"`
+	} `json:"album"`
+	Artists    []spotifyArtist `json:"artists"`
+	DurationMs int             `json:"duration_ms"`
+}
+
+// toTrack converts an API track. Album tracks carry no album of their own,
+// so the album name and release date can be passed in.
+func (t spotifyTrack) toTrack(album, releaseDate string) *Track {
+	if t.Album.Name != "" {
+		album, releaseDate = t.Album.Name, t.Album.ReleaseDate
+	}
+	var allArtists []string
+	for _, artist := range t.Artists {
+		allArtists = append(allArtists, artist.Name)
+	}
+	track := &Track{
+		Title:    t.Name,
+		Album:    album,
+		Artists:  allArtists,
+		Duration: t.DurationMs / 1000,
+	}
+	if len(allArtists) > 0 {
+		track.Artist = allArtists[0]
+	}
+	if len(releaseDate) >= 4 {
+		fmt.Sscanf(releaseDate, "%4d", &track.Year)
+	}
+	return track.buildTrack()
+}
+
+// getSpotifyJSON fetches an API endpoint and decodes its JSON body into v.
+func getSpotifyJSON(endpoint string, v any) error {
 	statusCode, jsonResponse, err := hitSpotifyEndpoints(endpoint)
 	if err != nil {
-		return nil, fmt.Errorf("error getting track info: %w", err)
+		return err
 	}
 	if statusCode != 200 {
-		return nil, fmt.Errorf("error from spotify: %d", statusCode)
+		return fmt.Errorf("error from spotify: %d", statusCode)
+	}
+	return json.Unmarshal([]byte(jsonResponse), v)
+}
+
+// GetAlbumInfo returns every track on an album, following the API's paging.
+func GetAlbumInfo(url string) ([]Track, error) {
+	// example url: https://open.spotify.com/album/4aawyAB9vmqN3uQ7FjRGTy
+	albumID, err := spotifyID(url, "album")
+	if err != nil {
+		return nil, err
+	}
+
+	type trackPage struct {
+		Items []spotifyTrack `json:"items"`
+		Next  string         `json:"next"`
+	}
+	var album struct {
+		Name        string    `json:"name"`
+		ReleaseDate string    `json:"release_date"`
+		Tracks      trackPage `json:"tracks"`
+	}
+	if err := getSpotifyJSON("https://api.spotify.com/v1/albums/"+albumID, &album); err != nil {
+		return nil, fmt.Errorf("error getting album info: %w", err)
 	}
 
-	var result struct {
-		Name  string `json:"name"`
-		Album struct {
-			Name        string `json:"name"`
-			ReleaseDate string `json:"release_date"`
-		} `json:"album"`
-		Artists []struct {
-			Name string `json:"name"`
-		} `json:"artists"`
-		DurationMs int `json:"duration_ms"`
+	var tracks []Track
+	page := album.Tracks
+	for {
+		for _, item := range page.Items {
+			tracks = append(tracks, *item.toTrack(album.Name, album.ReleaseDate))
+		}
+		if page.Next == "" {
+			break
+		}
+		next := page.Next
+		page = trackPage{}
+		if err := getSpotifyJSON(next, &page); err != nil {
+			return nil, fmt.Errorf("error getting album tracks: %w", err)
+		}
 	}
-	err = json.Unmarshal([]byte(jsonResponse), &result)
+	return tracks, nil
+}
+
+// GetPlaylistInfo returns every track in a playlist, following the API's
+// paging. Episodes and tracks that are no longer available are left out.
+func GetPlaylistInfo(url string) ([]Track, error) {
+	// example url: https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M
+	playlistID, err := spotifyID(url, "playlist")
 	if err != nil {
-		return nil, fmt.Errorf("error unmarshalling track info: %w", err)
+		return nil, err
 	}
-	var allArtists []string
-	for _, artist := range result.Artists {
-		allArtists = append(allArtists, artist.Name)
+
+	var tracks []Track
+	next := "https://api.spotify.com/v1/playlists/" + playlistID + "/tracks?limit=100"
+	for next != "" {
+		var page struct {
+			Items []struct {
+				Track *struct {
+					spotifyTrack
+					Type string `json:"type"`
+				} `json:"track"`
+			} `json:"items"`
+			Next string `json:"next"`
+		}
+		if err := getSpotifyJSON(next, &page); err != nil {
+			return nil, fmt.Errorf("error getting playlist tracks: %w", err)
+		}
+		for _, item := range page.Items {
+			if item.Track == nil || item.Track.Type != "track" || item.Track.Name == "" {
+				continue
+			}
+			tracks = append(tracks, *item.Track.toTrack("", ""))
+		}
+		next = page.Next
 	}
-	track := &Track{
-		Title:    result.Name,
-		Album:    result.Album.Name,
-		Artists:  allArtists,
-		Artist:   allArtists[0],
-		Duration: result.DurationMs / 1000,
+	return tracks, nil
+}
+
+func GetTrackInfo(url string) (*Track, error) {
+	// example url: https://open.spotify.com/track/2VOnMNQWQ44OqHWwvXn5z6\?si\=7f6007e3a57a4706
+	baseUrl := "https://api.spotify.com/v1/tracks/"
+	trackID, err := spotifyID(url, "track")
+	if err != nil {
+		return nil, err
 	}
-	if len(result.Album.ReleaseDate) >= 4 {
-		fmt.Sscanf(result.Album.ReleaseDate, "%4d", &track.Year)
+	var result spotifyTrack
+	if err := getSpotifyJSON(baseUrl+trackID, &result); err != nil {
+		return nil, fmt.Errorf("error getting track info: %w", err)
 	}
-	return track.buildTrack(), nil
+	return result.toTrack("", ""), nil
 }
@@ -0,0 +1,18 @@
+package spotify
+
+import "testing"
+
+func TestURLKind(t *testing.T) {
+	for url, want := range map[string]string{
+		"https://open.spotify.com/track/4uLU6hMCjMI75M1A2tKUQC":               "track",
+		"open.spotify.com/album/1DFixLWuPkv3KT3TnV35m3?si=abc":                "album",
+		"https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M":            "playlist",
+		"https://open.spotify.com/playlist/37i9dQZF1DXcBWIGoYBM5M?from=track": "playlist",
+		"https://open.spotify.com/album/soundtrack":                           "",
+		"https://example.com/track/4uLU6hMCjMI75M1A2tKUQC":                    "",
+	} {
+		if got := URLKind(url); got != want {
+			t.Errorf("URLKind(%q) = %q, want %q", url, got, want)
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package wavservice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"os"
+)
+
+// AudioDecoder streams decoded audio as interleaved samples normalised to
+// [-1.0, 1.0].
+type AudioDecoder interface {
+	SampleRate() int
+	Channels() int
+	// Duration is the length of the audio in seconds, or 0 when the format
+	// does not say up front.
+	Duration() float64
+	// ReadInterleaved fills dst with whole frames of interleaved samples and
+	// returns the number of samples written. It returns io.EOF once the audio
+	// is exhausted.
+	ReadInterleaved(dst []float64) (int, error)
+	Close() error
+}
+
+// OpenAudio opens an audio file with the decoder matching its signature:
+// WAV, FLAC, MP3 and Ogg Vorbis are decoded in Go, anything else, Ogg Opus
+// included, is piped through ffmpeg. The file extension is ignored.
+func OpenAudio(fileName string) (AudioDecoder, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 16)
+	n, err := io.ReadFull(file, header)
+	file.Close()
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, err
+	}
+	header = header[:n]
+
+	switch {
+	case len(header) >= 12 && bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")):
+		return OpenWavFile(fileName)
+	case bytes.HasPrefix(header, []byte("fLaC")):
+		return openFlac(fileName, 0)
+	case bytes.HasPrefix(header, []byte("ID3")) && len(header) >= 10:
+		// An ID3v2 tag may precede either MP3 or FLAC data.
+		// The tag size is a syncsafe integer: 7 bits per byte.
+		tagSize := 10 + (int64(header[6])<<21 | int64(header[7])<<14 | int64(header[8])<<7 | int64(header[9]))
+		if isFlacAt(fileName, tagSize) {
+			return openFlac(fileName, tagSize)
+		}
+		return openMP3(fileName)
+	case isMP3FrameSync(header):
+		return openMP3(fileName)
+	case bytes.HasPrefix(header, []byte("OggS")):
+		// Ogg also carries Opus and other codecs oggvorbis rejects.
+		if decoder, err := openOgg(fileName); err == nil {
+			return decoder, nil
+		}
+	}
+	return openFFmpeg(fileName)
+}
+
+// isMP3FrameSync reports whether header starts with an MPEG layer III frame.
+func isMP3FrameSync(header []byte) bool {
+	return len(header) >= 2 && header[0] == 0xFF && header[1]&0xE0 == 0xE0 && header[1]&0x06 == 0x02
+}
+
+func isFlacAt(fileName string, offset int64) bool {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	magic := make([]byte, 4)
+	_, err = file.ReadAt(magic, offset)
+	return err == nil && bytes.Equal(magic, []byte("fLaC"))
+}
+
+// MonoReader reduces the output of an AudioDecoder to mono with a Downmix.
+// It satisfies recognisingalgorithm.SampleReader.
+type MonoReader struct {
+	decoder AudioDecoder
+	downmix Downmix
+	buf     []float64
+}
+
+// NewMonoReader wraps decoder so it yields one sample per frame.
+func NewMonoReader(decoder AudioDecoder, downmix Downmix) *MonoReader {
+	return &MonoReader{decoder: decoder, downmix: downmix}
+}
+
+// ReadSamples reads up to len(dst) mono samples. It returns io.EOF once the
+// decoder is exhausted.
+func (m *MonoReader) ReadSamples(dst []float64) (int, error) {
+	channels := m.decoder.Channels()
+	if cap(m.buf) < len(dst)*channels {
+		m.buf = make([]float64, len(dst)*channels)
+	}
+	n, err := m.decoder.ReadInterleaved(m.buf[:len(dst)*channels])
+	frames := n / channels
+	for i := 0; i < frames; i++ {
+		dst[i] = m.downmix.mix(m.buf[i*channels : i*channels+channels])
+	}
+	return frames, err
+}
+
+// readS16 fills dst with whole frames of little-endian 16-bit PCM read from
+// r, reusing *buf between calls. It returns io.EOF once r is exhausted.
+func readS16(r io.Reader, dst []float64, channels int, buf *[]byte) (int, error) {
+	want := len(dst) / channels * channels * 2
+	if cap(*buf) < want {
+		*buf = make([]byte, want)
+	}
+	n, err := io.ReadFull(r, (*buf)[:want])
+	if err == io.ErrUnexpectedEOF {
+		err = nil
+	}
+	samples := n / (channels * 2) * channels
+	if samples == 0 && (err == nil || err == io.EOF) {
+		return 0, io.EOF
+	}
+	for i := 0; i < samples; i++ {
+		dst[i] = float64(int16(binary.LittleEndian.Uint16((*buf)[i*2:]))) / 32768.0
+	}
+	return samples, err
+}
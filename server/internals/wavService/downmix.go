@@ -0,0 +1,59 @@
+package wavservice
+
+import "fmt"
+
+// Downmix selects how multichannel audio is reduced to the mono signal that
+// gets fingerprinted. Mono audio is passed through unchanged by every mode.
+type Downmix string
+
+const (
+	DownmixAverage Downmix = "average" // Mean of every channel
+	DownmixLeft    Downmix = "left"    // First channel only
+	DownmixRight   Downmix = "right"   // Second channel only
+	DownmixMid     Downmix = "mid"     // (L+R)/2, ignoring any further channels
+	DownmixSide    Downmix = "side"    // (L-R)/2, which cancels centre-panned sources such as vocals
+)
+
+// ParseDownmix validates the name of a downmix mode.
+func ParseDownmix(name string) (Downmix, error) {
+	switch mode := Downmix(name); mode {
+	case DownmixAverage, DownmixLeft, DownmixRight, DownmixMid, DownmixSide:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown downmix %q, expected average, left, right, mid or side", name)
+}
+
+// mix reduces one frame, holding a sample of each channel, to one sample.
+func (d Downmix) mix(frame []float64) float64 {
+	if len(frame) == 1 {
+		return frame[0]
+	}
+	switch d {
+	case DownmixLeft:
+		return frame[0]
+	case DownmixRight:
+		return frame[1]
+	case DownmixMid:
+		return (frame[0] + frame[1]) / 2
+	case DownmixSide:
+		return (frame[0] - frame[1]) / 2
+	}
+	sum := 0.0
+	for _, sample := range frame {
+		sum += sample
+	}
+	return sum / float64(len(frame))
+}
+
+// DownmixSamples de-interleaves samples with the given number of channels
+// and reduces every frame to mono.
+func DownmixSamples(samples []float64, channels int, mode Downmix) ([]float64, error) {
+	if channels < 1 || len(samples)%channels != 0 {
+		return nil, fmt.Errorf("%d samples cannot be split into %d channels", len(samples), channels)
+	}
+	mono := make([]float64, len(samples)/channels)
+	for i := range mono {
+		mono[i] = mode.mix(samples[i*channels : i*channels+channels])
+	}
+	return mono, nil
+}
@@ -0,0 +1,108 @@
+package wavservice
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os/exec"
+	"time"
+)
+
+const (
+	ffmpegSampleRate = 44100           // Rate ffmpeg is asked to decode to
+	ffmpegWaitDelay  = 5 * time.Second // How long Close waits for input copying to stop
+)
+
+// ffmpegDecoder pipes any format ffmpeg understands to us as a 16-bit PCM
+// WAV stream, without writing a temporary file. The source channel count is
+// kept so the configured Downmix applies to every format alike; it is read
+// from the WAV header ffmpeg writes ahead of the samples.
+type ffmpegDecoder struct {
+	cmd      *exec.Cmd
+	reader   *bufio.Reader
+	stderr   bytes.Buffer
+	channels int
+	buf      []byte
+	waited   bool
+}
+
+func openFFmpeg(fileName string) (AudioDecoder, error) {
+	decoder, err := startFFmpeg(fileName, nil)
+	if err != nil {
+		return nil, fmt.Errorf("no Go decoder for %s and ffmpeg could not decode it: %v", fileName, err)
+	}
+	return decoder, nil
+}
+
+// NewFFmpegStreamDecoder decodes audio read from input, in any format ffmpeg
+// understands, by feeding it to ffmpeg's stdin as it arrives. Nothing is
+// written to disk. Containers that ffmpeg can only demux with seeking, such
+// as MP4 files with the index at the end, are not supported; fragmented MP4
+// as served by YouTube is.
+func NewFFmpegStreamDecoder(input io.Reader) (AudioDecoder, error) {
+	decoder, err := startFFmpeg("pipe:0", input)
+	if err != nil {
+		return nil, fmt.Errorf("ffmpeg could not decode the stream: %v", err)
+	}
+	return decoder, nil
+}
+
+func startFFmpeg(input string, stdin io.Reader) (*ffmpegDecoder, error) {
+	d := &ffmpegDecoder{}
+	d.cmd = exec.Command("ffmpeg", "-v", "error", "-i", input,
+		"-map_metadata", "-1", "-f", "wav", "-c:a", "pcm_s16le", "-ar", fmt.Sprint(ffmpegSampleRate), "-")
+	d.cmd.Stdin = stdin
+	// Once ffmpeg exits, don't wait for a stalled input reader.
+	d.cmd.WaitDelay = ffmpegWaitDelay
+	d.cmd.Stderr = &d.stderr
+	stdout, err := d.cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := d.cmd.Start(); err != nil {
+		return nil, err
+	}
+	d.reader = bufio.NewReader(stdout)
+
+	info, err := readRiffStream(d.reader)
+	if err != nil {
+		// ffmpeg may still be writing, and would block on the full pipe
+		// forever if we only waited for it.
+		d.Close()
+		return nil, fmt.Errorf("ffmpeg error: %v, output: %s", err, d.stderr.String())
+	}
+	if info.AudioFormat != WaveFormatPCM || info.BitsPerSample != 16 {
+		d.Close()
+		return nil, fmt.Errorf("ffmpeg wrote %d-bit samples of format %d, want 16-bit PCM", info.BitsPerSample, info.AudioFormat)
+	}
+	d.channels = int(info.NumChannels)
+	return d, nil
+}
+
+func (d *ffmpegDecoder) SampleRate() int   { return ffmpegSampleRate }
+func (d *ffmpegDecoder) Channels() int     { return d.channels }
+func (d *ffmpegDecoder) Duration() float64 { return 0 }
+
+func (d *ffmpegDecoder) ReadInterleaved(dst []float64) (int, error) {
+	n, err := readS16(d.reader, dst, d.channels, &d.buf)
+	if err == io.EOF && !d.waited {
+		// Only report the end once ffmpeg has exited cleanly, so a
+		// failed decode is not mistaken for a short file.
+		d.waited = true
+		if waitErr := d.cmd.Wait(); waitErr != nil {
+			return n, fmt.Errorf("ffmpeg error: %v, output: %s", waitErr, d.stderr.String())
+		}
+	}
+	return n, err
+}
+
+func (d *ffmpegDecoder) Close() error {
+	if d.waited {
+		return nil
+	}
+	d.waited = true
+	d.cmd.Process.Kill()
+	d.cmd.Wait()
+	return nil
+}
@@ -0,0 +1,76 @@
+package wavservice
+
+import (
+	"bufio"
+	"io"
+	"os"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+)
+
+// flacDecoder decodes FLAC one frame at a time.
+type flacDecoder struct {
+	file   *os.File
+	stream *flac.Stream
+	frame  *frame.Frame
+	pos    int     // Next sample of frame to return
+	scale  float64 // Full scale of the stream's sample width
+}
+
+// openFlac decodes the FLAC stream starting offset bytes into the file.
+func openFlac(fileName string, offset int64) (AudioDecoder, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := file.Seek(offset, io.SeekStart); err != nil {
+		file.Close()
+		return nil, err
+	}
+	stream, err := flac.New(bufio.NewReader(file))
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &flacDecoder{
+		file:   file,
+		stream: stream,
+		scale:  float64(int64(1) << (stream.Info.BitsPerSample - 1)),
+	}, nil
+}
+
+func (d *flacDecoder) SampleRate() int { return int(d.stream.Info.SampleRate) }
+func (d *flacDecoder) Channels() int   { return int(d.stream.Info.NChannels) }
+
+func (d *flacDecoder) Duration() float64 {
+	return float64(d.stream.Info.NSamples) / float64(d.stream.Info.SampleRate)
+}
+
+func (d *flacDecoder) ReadInterleaved(dst []float64) (int, error) {
+	channels := d.Channels()
+	n := 0
+	for n+channels <= len(dst) {
+		if d.frame == nil || d.pos >= d.frame.Subframes[0].NSamples {
+			next, err := d.stream.ParseNext()
+			if err == io.EOF && n > 0 {
+				break
+			}
+			if err != nil {
+				return n, err
+			}
+			d.frame, d.pos = next, 0
+			continue
+		}
+		for c := 0; c < channels; c++ {
+			dst[n+c] = float64(d.frame.Subframes[c].Samples[d.pos]) / d.scale
+		}
+		n += channels
+		d.pos++
+	}
+	return n, nil
+}
+
+func (d *flacDecoder) Close() error {
+	return d.file.Close()
+}
@@ -0,0 +1,91 @@
+package wavservice
+
+import (
+	"io"
+	"os"
+
+	"github.com/hajimehoshi/go-mp3"
+)
+
+// mp3Decoder decodes MPEG layer III, which go-mp3 always renders as 16-bit
+// stereo. For mono files it copies the one channel into both, so only the
+// left one is kept and mono stays mono for every Downmix.
+type mp3Decoder struct {
+	file     *os.File
+	decoder  *mp3.Decoder
+	channels int
+	stereo   []float64 // Decoded stereo frames of a mono file
+	buf      []byte
+}
+
+func openMP3(fileName string) (AudioDecoder, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	channels := mp3Channels(file)
+	decoder, err := mp3.NewDecoder(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &mp3Decoder{file: file, decoder: decoder, channels: channels}, nil
+}
+
+// mp3ScanBytes is how far past any ID3v2 tag mp3Channels looks for a frame.
+const mp3ScanBytes = 64 << 10
+
+// mp3Channels reads the channel mode from the first frame header of file,
+// skipping any ID3v2 tag. Files whose header is not found count as stereo.
+func mp3Channels(file io.ReaderAt) int {
+	var offset int64
+	tag := make([]byte, 10)
+	if _, err := file.ReadAt(tag, 0); err == nil && string(tag[0:3]) == "ID3" {
+		// The tag size is a syncsafe integer: 7 bits per byte.
+		offset = 10 + (int64(tag[6])<<21 | int64(tag[7])<<14 | int64(tag[8])<<7 | int64(tag[9]))
+		if tag[5]&0x10 != 0 {
+			offset += 10 // Footer
+		}
+	}
+	data := make([]byte, mp3ScanBytes)
+	n, _ := file.ReadAt(data, offset)
+	data = data[:n]
+	for i := 0; i+4 <= len(data); i++ {
+		header := data[i : i+4]
+		bitrate, sampleRate := header[2]>>4, header[2]>>2&0x03
+		if !isMP3FrameSync(header) || header[1]&0x18 == 0x08 || bitrate == 0 || bitrate == 15 || sampleRate == 3 {
+			continue
+		}
+		if header[3]>>6 == 3 {
+			return 1
+		}
+		return 2
+	}
+	return 2
+}
+
+func (d *mp3Decoder) SampleRate() int { return d.decoder.SampleRate() }
+func (d *mp3Decoder) Channels() int   { return d.channels }
+
+func (d *mp3Decoder) Duration() float64 {
+	// Length is in bytes of 16-bit stereo output.
+	return float64(d.decoder.Length()) / 4 / float64(d.decoder.SampleRate())
+}
+
+func (d *mp3Decoder) ReadInterleaved(dst []float64) (int, error) {
+	if d.channels == 2 {
+		return readS16(d.decoder, dst, 2, &d.buf)
+	}
+	if cap(d.stereo) < 2*len(dst) {
+		d.stereo = make([]float64, 2*len(dst))
+	}
+	n, err := readS16(d.decoder, d.stereo[:2*len(dst)], 2, &d.buf)
+	for i := 0; i < n/2; i++ {
+		dst[i] = d.stereo[2*i]
+	}
+	return n / 2, err
+}
+
+func (d *mp3Decoder) Close() error {
+	return d.file.Close()
+}
@@ -0,0 +1,31 @@
+package wavservice
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMP3Channels(t *testing.T) {
+	mono := []byte{0xFF, 0xFB, 0x90, 0xC4}   // MPEG-1 layer III, 128 kbit/s, 44.1 kHz, mono
+	stereo := []byte{0xFF, 0xFB, 0x90, 0x44} // The same in joint stereo
+	id3 := append([]byte("ID3\x04\x00\x00\x00\x00\x01\x00"), make([]byte, 128)...)
+	// A sync word with a free bitrate inside the tag must not be taken for a frame.
+	copy(id3[20:], []byte{0xFF, 0xFB, 0x00, 0xC4})
+
+	tests := []struct {
+		name string
+		file []byte
+		want int
+	}{
+		{"mono", mono, 1},
+		{"stereo", stereo, 2},
+		{"mono after ID3 tag", append(append([]byte{}, id3...), mono...), 1},
+		{"mono after leading junk", append([]byte{0, 0xFF, 0x00, 0xFF}, mono...), 1},
+		{"no frame", []byte("not an mp3"), 2},
+	}
+	for _, tt := range tests {
+		if got := mp3Channels(bytes.NewReader(tt.file)); got != tt.want {
+			t.Errorf("%s: %d channels, want %d", tt.name, got, tt.want)
+		}
+	}
+}
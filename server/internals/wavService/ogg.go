@@ -0,0 +1,55 @@
+package wavservice
+
+import (
+	"io"
+	"os"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+// oggDecoder decodes Ogg Vorbis, which oggvorbis renders as interleaved
+// float32 samples.
+type oggDecoder struct {
+	file   *os.File
+	reader *oggvorbis.Reader
+	buf    []float32
+}
+
+func openOgg(fileName string) (AudioDecoder, error) {
+	file, err := os.Open(fileName)
+	if err != nil {
+		return nil, err
+	}
+	reader, err := oggvorbis.NewReader(file)
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+	return &oggDecoder{file: file, reader: reader}, nil
+}
+
+func (d *oggDecoder) SampleRate() int { return d.reader.SampleRate() }
+func (d *oggDecoder) Channels() int   { return d.reader.Channels() }
+
+func (d *oggDecoder) Duration() float64 {
+	// Length is in samples per channel, known because the file is seekable.
+	return float64(d.reader.Length()) / float64(d.reader.SampleRate())
+}
+
+func (d *oggDecoder) ReadInterleaved(dst []float64) (int, error) {
+	if cap(d.buf) < len(dst) {
+		d.buf = make([]float32, len(dst))
+	}
+	n, err := d.reader.Read(d.buf[:len(dst)])
+	for i := 0; i < n; i++ {
+		dst[i] = float64(d.buf[i])
+	}
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func (d *oggDecoder) Close() error {
+	return d.file.Close()
+}
@@ -0,0 +1,230 @@
+package wavservice
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// infoTags maps the LIST INFO chunk IDs to the tag names ReadTags uses.
+// IDs missing here are kept under their lower-cased four letter code.
+var infoTags = map[string]string{
+	"INAM": "title",
+	"IART": "artist",
+	"IPRD": "album",
+	"IGNR": "genre",
+	"ICRD": "date",
+	"ICMT": "comment",
+	"ITRK": "track",
+	"ICOP": "copyright",
+	"ISFT": "encoder",
+}
+
+// Largest fmt and LIST chunks readRiffStream reads into memory. A stream's
+// chunk sizes cannot be checked against a file size, so a corrupt header
+// must not make it allocate up to 4 GiB.
+const (
+	maxStreamFmtChunk  = 64
+	maxStreamListChunk = 256 << 10
+)
+
+// wavLayout is where the parts of a WAV file were found by readRiff.
+type wavLayout struct {
+	info       *WavInformation // Format and metadata; Data and Duration are not set
+	dataOffset int64           // Offset of the first sample byte
+	dataSize   int64           // Bytes of sample data
+}
+
+// readRiff walks every chunk of a RIFF/WAVE stream. The fmt and data chunks
+// may appear in any order and position among other chunks such as LIST,
+// bext, fact or JUNK, which are skipped apart from LIST INFO metadata.
+// Chunks are word aligned, so a pad byte follows every odd-sized one. A data
+// chunk whose size runs past the end of the file, as left behind by encoders
+// writing to a pipe, is taken to extend to the end of the file.
+func readRiff(r io.ReadSeeker) (*wavLayout, error) {
+	fileSize, err := r.Seek(0, io.SeekEnd)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, fmt.Errorf("file too small to be a valid WAV file")
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("invalid WAV file format")
+	}
+
+	layout := &wavLayout{info: &WavInformation{}, dataOffset: -1}
+	foundFmt := false
+	offset := int64(12)
+	for offset+8 <= fileSize {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, err
+		}
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		body := offset + 8
+		if body+size > fileSize {
+			if id != "data" {
+				// A truncated trailing chunk holds nothing we need.
+				break
+			}
+			size = fileSize - body
+		}
+
+		switch id {
+		case "fmt ":
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return nil, err
+			}
+			if err := parseFmtChunk(chunk, layout.info); err != nil {
+				return nil, err
+			}
+			foundFmt = true
+		case "LIST":
+			chunk := make([]byte, size)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return nil, err
+			}
+			parseListChunk(chunk, layout.info)
+		case "data":
+			if layout.dataOffset < 0 {
+				layout.dataOffset, layout.dataSize = body, size
+			}
+		}
+
+		offset = body + size + size%2
+		if _, err := r.Seek(offset, io.SeekStart); err != nil {
+			return nil, err
+		}
+	}
+
+	if !foundFmt {
+		return nil, errors.New("WAV file has no fmt chunk")
+	}
+	if layout.dataOffset < 0 {
+		return nil, errors.New("WAV file has no data chunk")
+	}
+	if _, err := r.Seek(layout.dataOffset, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return layout, nil
+}
+
+// readRiffStream reads a RIFF/WAVE header from a stream that cannot seek,
+// such as ffmpeg's stdout, and stops at the start of the data chunk. The
+// fmt chunk must come first, as the data size is not trusted and everything
+// after the data chunk header is taken to be samples.
+func readRiffStream(r io.Reader) (*WavInformation, error) {
+	var riff [12]byte
+	if _, err := io.ReadFull(r, riff[:]); err != nil {
+		return nil, fmt.Errorf("stream too short to be a valid WAV stream")
+	}
+	if string(riff[0:4]) != "RIFF" || string(riff[8:12]) != "WAVE" {
+		return nil, fmt.Errorf("invalid WAV stream format")
+	}
+
+	info := &WavInformation{}
+	foundFmt := false
+	for {
+		var header [8]byte
+		if _, err := io.ReadFull(r, header[:]); err != nil {
+			return nil, fmt.Errorf("WAV stream ended before the data chunk")
+		}
+		id := string(header[0:4])
+		size := int64(binary.LittleEndian.Uint32(header[4:8]))
+		switch id {
+		case "data":
+			if !foundFmt {
+				return nil, errors.New("WAV stream has no fmt chunk before the data chunk")
+			}
+			return info, nil
+		case "fmt ", "LIST":
+			limit := int64(maxStreamFmtChunk)
+			if id == "LIST" {
+				limit = maxStreamListChunk
+			}
+			if size > limit {
+				return nil, fmt.Errorf("WAV stream %q chunk is %d bytes, more than the %d allowed", id, size, limit)
+			}
+			chunk := make([]byte, size+size%2)
+			if _, err := io.ReadFull(r, chunk); err != nil {
+				return nil, err
+			}
+			if id == "LIST" {
+				parseListChunk(chunk[:size], info)
+				continue
+			}
+			if err := parseFmtChunk(chunk[:size], info); err != nil {
+				return nil, err
+			}
+			foundFmt = true
+		default:
+			if _, err := io.CopyN(io.Discard, r, size+size%2); err != nil {
+				return nil, err
+			}
+		}
+	}
+}
+
+// parseFmtChunk reads the 16, 18 or 40 byte format chunk. For
+// WAVE_FORMAT_EXTENSIBLE the format tag is taken from the SubFormat GUID, so
+// AudioFormat always names the actual sample encoding.
+func parseFmtChunk(chunk []byte, info *WavInformation) error {
+	if len(chunk) < 16 {
+		return fmt.Errorf("WAV fmt chunk is %d bytes, want at least 16", len(chunk))
+	}
+	info.AudioFormat = binary.LittleEndian.Uint16(chunk[0:2])
+	if info.AudioFormat == WaveFormatExtensible {
+		if len(chunk) < 40 {
+			return fmt.Errorf("WAV extensible fmt chunk is %d bytes, want 40", len(chunk))
+		}
+		info.AudioFormat = binary.LittleEndian.Uint16(chunk[24:26])
+	}
+	info.NumChannels = binary.LittleEndian.Uint16(chunk[2:4])
+	info.SampleRate = binary.LittleEndian.Uint32(chunk[4:8])
+	info.BlockAlign = binary.LittleEndian.Uint16(chunk[12:14])
+	info.BitsPerSample = binary.LittleEndian.Uint16(chunk[14:16])
+	if info.NumChannels == 0 || info.SampleRate == 0 {
+		return fmt.Errorf("invalid WAV file format")
+	}
+	return nil
+}
+
+// parseListChunk collects the text entries of a LIST INFO chunk into
+// info.Metadata. Other list types, such as adtl cue labels, are ignored.
+func parseListChunk(chunk []byte, info *WavInformation) {
+	if len(chunk) < 4 || string(chunk[0:4]) != "INFO" {
+		return
+	}
+	for pos := 4; pos+8 <= len(chunk); {
+		id := string(chunk[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(chunk[pos+4 : pos+8]))
+		pos += 8
+		if size > len(chunk)-pos {
+			return
+		}
+		value := strings.TrimSpace(strings.TrimRight(string(chunk[pos:pos+size]), "\x00"))
+		pos += size + size%2
+
+		if value == "" {
+			continue
+		}
+		key, ok := infoTags[id]
+		if !ok {
+			key = strings.ToLower(id)
+		}
+		if info.Metadata == nil {
+			info.Metadata = map[string]string{}
+		}
+		info.Metadata[key] = value
+	}
+}
@@ -0,0 +1,249 @@
+package wavservice
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+// chunk encodes a RIFF chunk, with the pad byte an odd-sized body needs.
+func chunk(id string, body []byte) []byte {
+	out := append([]byte(id), binary.LittleEndian.AppendUint32(nil, uint32(len(body)))...)
+	out = append(out, body...)
+	if len(body)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// riffFile wraps chunks in a RIFF/WAVE header.
+func riffFile(chunks ...[]byte) []byte {
+	body := []byte("WAVE")
+	for _, c := range chunks {
+		body = append(body, c...)
+	}
+	return append([]byte("RIFF"), append(binary.LittleEndian.AppendUint32(nil, uint32(len(body))), body...)...)
+}
+
+// fmtBody encodes a fmt chunk body of size 16, 18 or 40 bytes. A 40-byte
+// body is WAVE_FORMAT_EXTENSIBLE with format as its SubFormat.
+func fmtBody(size int, format, channels uint16, sampleRate uint32, bits uint16) []byte {
+	tag := format
+	if size == 40 {
+		tag = WaveFormatExtensible
+	}
+	blockAlign := channels * bits / 8
+	b := binary.LittleEndian.AppendUint16(nil, tag)
+	b = binary.LittleEndian.AppendUint16(b, channels)
+	b = binary.LittleEndian.AppendUint32(b, sampleRate)
+	b = binary.LittleEndian.AppendUint32(b, sampleRate*uint32(blockAlign))
+	b = binary.LittleEndian.AppendUint16(b, blockAlign)
+	b = binary.LittleEndian.AppendUint16(b, bits)
+	switch size {
+	case 18:
+		b = binary.LittleEndian.AppendUint16(b, 0)
+	case 40:
+		b = binary.LittleEndian.AppendUint16(b, 22)
+		b = binary.LittleEndian.AppendUint16(b, bits)
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint16(b, format)
+		b = append(b, "\x00\x00\x00\x00\x10\x00\x80\x00\x00\xaa\x00\x38\x9b\x71"...)
+	}
+	return b
+}
+
+// infoList encodes a LIST INFO chunk body from id, value pairs.
+func infoList(pairs ...string) []byte {
+	b := []byte("INFO")
+	for i := 0; i+1 < len(pairs); i += 2 {
+		b = append(b, chunk(pairs[i], []byte(pairs[i+1]+"\x00"))...)
+	}
+	return b
+}
+
+func TestReadRiff(t *testing.T) {
+	pcm := fmtBody(16, WaveFormatPCM, 2, 44100, 16)
+	samples := []byte{1, 2, 3, 4, 5, 6, 7, 8}
+
+	tests := []struct {
+		name       string
+		file       []byte
+		wantFormat uint16
+		wantOffset int64
+		wantSize   int64
+		wantTags   map[string]string
+	}{
+		{
+			name: "LIST, bext and JUNK before fmt",
+			file: riffFile(
+				chunk("LIST", infoList("INAM", "Song", "IART", "Band")),
+				chunk("bext", make([]byte, 602)),
+				chunk("JUNK", make([]byte, 28)),
+				chunk("fmt ", pcm),
+				chunk("data", samples)),
+			wantFormat: WaveFormatPCM,
+			wantOffset: 12 + 8 + 32 + 8 + 602 + 8 + 28 + 8 + 16 + 8,
+			wantSize:   8,
+			wantTags:   map[string]string{"title": "Song", "artist": "Band"},
+		},
+		{
+			name: "odd-sized chunk and value with pad bytes",
+			file: riffFile(
+				chunk("JUNK", make([]byte, 3)),
+				chunk("fmt ", pcm),
+				chunk("LIST", infoList("INAM", "Odd", "ICMT", "x")),
+				chunk("data", samples)),
+			wantFormat: WaveFormatPCM,
+			wantOffset: 12 + 8 + 4 + 8 + 16 + 8 + 26 + 8,
+			wantSize:   8,
+			wantTags:   map[string]string{"title": "Odd", "comment": "x"},
+		},
+		{
+			name:       "18-byte fmt",
+			file:       riffFile(chunk("fmt ", fmtBody(18, WaveFormatPCM, 1, 8000, 8)), chunk("data", samples)),
+			wantFormat: WaveFormatPCM,
+			wantOffset: 12 + 8 + 18 + 8,
+			wantSize:   8,
+		},
+		{
+			name:       "40-byte extensible fmt",
+			file:       riffFile(chunk("fmt ", fmtBody(40, WaveFormatIEEEFloat, 2, 48000, 32)), chunk("data", samples)),
+			wantFormat: WaveFormatIEEEFloat,
+			wantOffset: 12 + 8 + 40 + 8,
+			wantSize:   8,
+		},
+		{
+			name:       "data before fmt",
+			file:       riffFile(chunk("data", samples), chunk("fmt ", pcm)),
+			wantFormat: WaveFormatPCM,
+			wantOffset: 12 + 8,
+			wantSize:   8,
+		},
+		{
+			name: "data size past the end of the file",
+			file: func() []byte {
+				file := riffFile(chunk("fmt ", pcm), chunk("data", samples))
+				binary.LittleEndian.PutUint32(file[len(file)-len(samples)-4:], 0xFFFFFFFF)
+				return file
+			}(),
+			wantFormat: WaveFormatPCM,
+			wantOffset: 12 + 8 + 16 + 8,
+			wantSize:   8,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := bytes.NewReader(tt.file)
+			layout, err := readRiff(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if layout.info.AudioFormat != tt.wantFormat {
+				t.Errorf("AudioFormat = %d, want %d", layout.info.AudioFormat, tt.wantFormat)
+			}
+			if layout.dataOffset != tt.wantOffset || layout.dataSize != tt.wantSize {
+				t.Errorf("data at %d+%d, want %d+%d", layout.dataOffset, layout.dataSize, tt.wantOffset, tt.wantSize)
+			}
+			if pos, _ := r.Seek(0, io.SeekCurrent); pos != tt.wantOffset {
+				t.Errorf("reader left at %d, want the data offset %d", pos, tt.wantOffset)
+			}
+			if len(layout.info.Metadata) != len(tt.wantTags) {
+				t.Errorf("Metadata = %v, want %v", layout.info.Metadata, tt.wantTags)
+			}
+			for key, want := range tt.wantTags {
+				if got := layout.info.Metadata[key]; got != want {
+					t.Errorf("Metadata[%q] = %q, want %q", key, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestReadRiffErrors(t *testing.T) {
+	for name, file := range map[string][]byte{
+		"not RIFF":      []byte("RIFX\x04\x00\x00\x00WAVE"),
+		"no fmt chunk":  riffFile(chunk("data", []byte{0, 0})),
+		"no data chunk": riffFile(chunk("fmt ", fmtBody(16, WaveFormatPCM, 1, 8000, 16))),
+		"short fmt":     riffFile(chunk("fmt ", make([]byte, 14)), chunk("data", []byte{0, 0})),
+	} {
+		if _, err := readRiff(bytes.NewReader(file)); err == nil {
+			t.Errorf("%s: readRiff succeeded", name)
+		}
+	}
+}
+
+func TestParseFmtChunk(t *testing.T) {
+	for _, size := range []int{16, 18, 40} {
+		var info WavInformation
+		if err := parseFmtChunk(fmtBody(size, WaveFormatPCM, 6, 48000, 24), &info); err != nil {
+			t.Fatalf("%d bytes: %v", size, err)
+		}
+		if info.AudioFormat != WaveFormatPCM || info.NumChannels != 6 || info.SampleRate != 48000 ||
+			info.BlockAlign != 18 || info.BitsPerSample != 24 {
+			t.Errorf("%d bytes: got %+v", size, info)
+		}
+	}
+
+	// An extensible tag needs the SubFormat GUID of a 40-byte chunk.
+	truncated := fmtBody(40, WaveFormatPCM, 2, 44100, 16)[:18]
+	if err := parseFmtChunk(truncated, &WavInformation{}); err == nil {
+		t.Error("18-byte extensible fmt chunk accepted")
+	}
+}
+
+func TestParseListChunk(t *testing.T) {
+	var info WavInformation
+	body := infoList("INAM", "Title", "IXYZ", "Custom", "IART", "  ")
+	// A truncated last entry is ignored.
+	body = append(body, chunk("IPRD", []byte("Album"))[:10]...)
+	parseListChunk(body, &info)
+	want := map[string]string{"title": "Title", "ixyz": "Custom"}
+	if len(info.Metadata) != len(want) || info.Metadata["title"] != "Title" || info.Metadata["ixyz"] != "Custom" {
+		t.Errorf("Metadata = %v, want %v", info.Metadata, want)
+	}
+
+	info = WavInformation{}
+	parseListChunk(append([]byte("adtl"), chunk("labl", []byte("cue"))...), &info)
+	if info.Metadata != nil {
+		t.Errorf("adtl list gave Metadata %v", info.Metadata)
+	}
+}
+
+func TestReadRiffStream(t *testing.T) {
+	file := riffFile(
+		chunk("LIST", infoList("ISFT", "Lavf")),
+		chunk("fmt ", fmtBody(40, WaveFormatPCM, 6, 44100, 16)),
+		chunk("data", []byte{1, 2}))
+	binary.LittleEndian.PutUint32(file[len(file)-6:], 0xFFFFFFFF)
+	r := bytes.NewReader(file)
+	info, err := readRiffStream(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.AudioFormat != WaveFormatPCM || info.NumChannels != 6 || info.BitsPerSample != 16 {
+		t.Errorf("got %+v", info)
+	}
+	if r.Len() != 2 {
+		t.Errorf("%d bytes left after the header, want the 2 sample bytes", r.Len())
+	}
+
+	if _, err := readRiffStream(bytes.NewReader(riffFile(chunk("data", []byte{0, 0})))); err == nil {
+		t.Error("data before fmt accepted on a stream")
+	}
+
+	for name, file := range map[string][]byte{
+		"oversized fmt":  riffFile(chunk("fmt ", make([]byte, maxStreamFmtChunk+2)), chunk("data", []byte{0, 0})),
+		"oversized LIST": riffFile(chunk("LIST", make([]byte, maxStreamListChunk+2)), chunk("fmt ", fmtBody(16, WaveFormatPCM, 1, 8000, 16)), chunk("data", []byte{0, 0})),
+	} {
+		if _, err := readRiffStream(bytes.NewReader(file)); err == nil {
+			t.Errorf("%s: readRiffStream succeeded", name)
+		}
+	}
+	// A header claiming a 4 GiB LIST is rejected before anything is read.
+	huge := []byte("RIFF\xff\xff\xff\xffWAVELIST\xff\xff\xff\xff")
+	if _, err := readRiffStream(bytes.NewReader(huge)); err == nil {
+		t.Error("4 GiB LIST chunk accepted")
+	}
+}
@@ -0,0 +1,71 @@
+package wavservice
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+)
+
+// Format tags found in the fmt chunk. WAVE_FORMAT_EXTENSIBLE files carry the
+// real tag in the first two bytes of their SubFormat GUID.
+const (
+	WaveFormatPCM        = 0x0001
+	WaveFormatIEEEFloat  = 0x0003
+	WaveFormatExtensible = 0xFFFE
+)
+
+// sampleDecoder turns the bytes of one sample into a value normalised to
+// [-1.0, 1.0].
+type sampleDecoder func(b []byte) float64
+
+// newSampleDecoder returns the decoder for a format tag and sample width,
+// along with the number of bytes each sample takes.
+func newSampleDecoder(audioFormat, bitsPerSample uint16) (sampleDecoder, int, error) {
+	switch {
+	case audioFormat == WaveFormatPCM && bitsPerSample == 8:
+		// 8-bit PCM is the only unsigned width, centred on 128.
+		return func(b []byte) float64 { return (float64(b[0]) - 128) / 128 }, 1, nil
+	case audioFormat == WaveFormatPCM && bitsPerSample == 16:
+		return func(b []byte) float64 {
+			return float64(int16(binary.LittleEndian.Uint16(b))) / 32768.0
+		}, 2, nil
+	case audioFormat == WaveFormatPCM && bitsPerSample == 24:
+		return func(b []byte) float64 {
+			// Shift into the top of an int32 so the sign is extended.
+			v := int32(uint32(b[0])<<8|uint32(b[1])<<16|uint32(b[2])<<24) >> 8
+			return float64(v) / (1 << 23)
+		}, 3, nil
+	case audioFormat == WaveFormatPCM && bitsPerSample == 32:
+		return func(b []byte) float64 {
+			return float64(int32(binary.LittleEndian.Uint32(b))) / (1 << 31)
+		}, 4, nil
+	case audioFormat == WaveFormatIEEEFloat && bitsPerSample == 32:
+		return func(b []byte) float64 {
+			return float64(math.Float32frombits(binary.LittleEndian.Uint32(b)))
+		}, 4, nil
+	case audioFormat == WaveFormatIEEEFloat && bitsPerSample == 64:
+		return func(b []byte) float64 {
+			return math.Float64frombits(binary.LittleEndian.Uint64(b))
+		}, 8, nil
+	}
+	return nil, 0, fmt.Errorf("unsupported WAV sample format: audio format %d with %d bits per sample", audioFormat, bitsPerSample)
+}
+
+// DecodeWavData converts interleaved sample data of the given format, PCM of
+// 8, 16, 24 or 32 bits or IEEE float of 32 or 64 bits, to float samples
+// normalised to [-1.0, 1.0].
+func DecodeWavData(data []byte, audioFormat, bitsPerSample uint16) ([]float64, error) {
+	decode, width, err := newSampleDecoder(audioFormat, bitsPerSample)
+	if err != nil {
+		return nil, err
+	}
+	if len(data)%width != 0 {
+		return nil, fmt.Errorf("wav data length %d is not a multiple of the %d-byte sample size", len(data), width)
+	}
+
+	samples := make([]float64, len(data)/width)
+	for i := range samples {
+		samples[i] = decode(data[i*width : i*width+width])
+	}
+	return samples, nil
+}
@@ -1,15 +1,17 @@
 package wavservice
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/binary"
+	"errors"
 	"fmt"
+	"io"
 	"os"
-	"os/exec"
-	"path/filepath"
+	"strconv"
 	"strings"
 
-	"github.com/Pritam-deb/echo-sense/utils"
+	"github.com/dhowden/tag"
 )
 
 type WavHeader struct {
@@ -29,88 +31,200 @@ type WavHeader struct {
 }
 
 type WavInformation struct {
+	AudioFormat   uint16 // WaveFormatPCM or WaveFormatIEEEFloat, resolved for extensible files
 	NumChannels   uint16
 	SampleRate    uint32
+	BlockAlign    uint16 // Bytes per frame of all channels
 	BitsPerSample uint16
-	Duration      float64 // in seconds
+	Duration      float64           // in seconds
+	Metadata      map[string]string // LIST INFO entries keyed like ReadTags, e.g. "title" and "artist"
 	Data          []byte
 }
 
-func ConvertToWav(inputFilePath string, channels int) (wavFilePath string, err error) {
-	_, err = os.Stat(inputFilePath)
-	if os.IsNotExist(err) {
-		return "", fmt.Errorf("input file does not exist: %s", inputFilePath)
+// ReadTags returns the metadata tags embedded in an audio file, such as
+// title, artist and album: the LIST INFO chunk of WAV files, Vorbis comments
+// of FLAC and Ogg files, ID3 tags of MP3 files and the atoms of MP4 files.
+// Keys are lower-cased; a file without tags yields an empty map.
+func ReadTags(inputFilePath string) (map[string]string, error) {
+	file, err := os.Open(inputFilePath)
+	if err != nil {
+		return nil, err
 	}
+	defer file.Close()
 
-	if channels < 1 || channels > 2 {
-		channels = 1 // default to mono if invalid channel count
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(file, header); err != nil {
+		return nil, err
+	}
+	if bytes.Equal(header[0:4], []byte("RIFF")) && bytes.Equal(header[8:12], []byte("WAVE")) {
+		layout, err := readRiff(file)
+		if err != nil {
+			return nil, err
+		}
+		if layout.info.Metadata == nil {
+			return map[string]string{}, nil
+		}
+		return layout.info.Metadata, nil
 	}
 
-	fileExt := filepath.Ext(inputFilePath)
-	outputFile := strings.TrimSuffix(inputFilePath, fileExt) + ".wav"
-	tmpFile := filepath.Join(filepath.Dir(outputFile), "tmp_"+filepath.Base(outputFile))
-	defer os.Remove(tmpFile) // clean up temp file if exists
-
-	// Construct ffmpeg command
-	cmdArgs := []string{"-y", "-i", inputFilePath, "-c", "pcm_s16le", "-ar", "44100", "-ac", fmt.Sprint(channels), tmpFile}
-	cmd := exec.Command("ffmpeg", cmdArgs...)
-	output, err := cmd.CombinedOutput() // run command
-	if err != nil {
-		return "", fmt.Errorf("ffmpeg error: %v, output: %s", err, string(output))
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	metadata, err := tag.ReadFrom(file)
+	if errors.Is(err, tag.ErrNoTagsFound) {
+		return map[string]string{}, nil
 	}
-	err = utils.MoveFile(tmpFile, outputFile) // rename temp file to final output
 	if err != nil {
-		return "", fmt.Errorf("failed to rename temp file: %v", err)
+		return nil, fmt.Errorf("failed to read tags: %v", err)
+	}
+
+	tags := map[string]string{}
+	set := func(key, value string) {
+		if value = strings.TrimSpace(value); value != "" {
+			tags[key] = value
+		}
+	}
+	set("title", metadata.Title())
+	set("artist", metadata.Artist())
+	set("album", metadata.Album())
+	set("album_artist", metadata.AlbumArtist())
+	set("composer", metadata.Composer())
+	set("genre", metadata.Genre())
+	set("comment", metadata.Comment())
+	if year := metadata.Year(); year > 0 {
+		tags["date"] = strconv.Itoa(year)
+	}
+	if track, _ := metadata.Track(); track > 0 {
+		tags["track"] = strconv.Itoa(track)
 	}
-	fmt.Println("WAV file created at:", outputFile)
-	return outputFile, nil
+	return tags, nil
+}
+
+// WavReader streams the samples of a WAV file without loading it into
+// memory, decoding any format DecodeWavData supports. It is the
+// AudioDecoder OpenAudio uses for WAV files.
+type WavReader struct {
+	Info      *WavInformation // Format and duration of the file; Data is left empty
+	decode    sampleDecoder
+	width     int // Bytes per sample
+	file      *os.File
+	reader    *bufio.Reader
+	remaining int64 // Bytes of sample data not yet read
+	buf       []byte
 }
 
-func ReadWavFile(fileName string) (*WavInformation, error) {
-	data, err := os.ReadFile(fileName)
+// OpenWavFile opens a WAV file for streaming. Its chunks are walked first,
+// so metadata stored after the samples is available in Info as well.
+func OpenWavFile(fileName string) (*WavReader, error) {
+	file, err := os.Open(fileName)
 	if err != nil {
 		return nil, err
 	}
-	if len(data) < 44 {
-		return nil, fmt.Errorf("file too small to be a valid WAV file")
+	layout, err := readRiff(file)
+	if err != nil {
+		file.Close()
+		return nil, err
 	}
-	var header WavHeader
-	err = binary.Read(bytes.NewReader(data[:44]), binary.LittleEndian, &header)
+	info := layout.info
+	decode, width, err := newSampleDecoder(info.AudioFormat, info.BitsPerSample)
 	if err != nil {
+		file.Close()
 		return nil, err
 	}
-	fmt.Printf("WAV Header: %+v\n", header)
+	info.Duration = float64(layout.dataSize) / float64(int(info.NumChannels)*width*int(info.SampleRate))
+	return &WavReader{
+		Info:      info,
+		decode:    decode,
+		width:     width,
+		file:      file,
+		reader:    bufio.NewReader(file),
+		remaining: layout.dataSize,
+	}, nil
+}
 
-	if string(header.ChunkID[:]) != "RIFF" || string(header.Format[:]) != "WAVE" || string(header.Subchunk1ID[:]) != "fmt " || header.AudioFormat != 1 {
-		return nil, fmt.Errorf("invalid WAV file format")
-	}
+func (w *WavReader) SampleRate() int   { return int(w.Info.SampleRate) }
+func (w *WavReader) Channels() int     { return int(w.Info.NumChannels) }
+func (w *WavReader) Duration() float64 { return w.Info.Duration }
 
-	info := &WavInformation{
-		NumChannels:   header.NumChannels,
-		SampleRate:    header.SampleRate,
-		BitsPerSample: header.BitsPerSample,
-		Data:          data[44:],
+// ReadInterleaved reads up to len(dst) samples normalised to [-1.0, 1.0],
+// always whole frames. It returns io.EOF once the data chunk is exhausted.
+func (w *WavReader) ReadInterleaved(dst []float64) (int, error) {
+	frameBytes := int64(w.Channels() * w.width)
+	want := int64(len(dst)/w.Channels()) * frameBytes
+	if want > w.remaining {
+		want = w.remaining - w.remaining%frameBytes
 	}
-	fmt.Printf("WAV Info - Channels: %d, SampleRate: %d, BitsPerSample: %d, Duration: %.2f seconds\n", info.NumChannels, info.SampleRate, info.BitsPerSample, info.Duration)
-	if header.BitsPerSample != 16 {
-		return nil, fmt.Errorf("unsupported BitsPerSample: %d, only 16 is supported", header.BitsPerSample)
+	if want == 0 {
+		return 0, io.EOF
 	}
-	info.Duration = float64(len(info.Data)) / float64(int(header.NumChannels)*2*int(header.SampleRate))
-	return info, nil
-}
+	if int64(cap(w.buf)) < want {
+		w.buf = make([]byte, want)
+	}
+	buf := w.buf[:want]
+	n, err := io.ReadFull(w.reader, buf)
+	if errors.Is(err, io.ErrUnexpectedEOF) {
+		// A truncated file ends at the last whole frame.
+		w.remaining = int64(n)
+		err = nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	w.remaining -= int64(n)
 
-func ConvertWavDataToSamples(wavData []byte) ([]float64, error) {
-	if len(wavData)%2 != 0 {
-		return nil, fmt.Errorf("wav data length is not even, cannot convert to 16-bit samples")
+	samples := n / int(frameBytes) * w.Channels()
+	for i := 0; i < samples; i++ {
+		dst[i] = w.decode(buf[i*w.width : i*w.width+w.width])
 	}
+	return samples, nil
+}
 
-	numSamples := len(wavData) / 2
-	samples := make([]float64, numSamples)
+// Close closes the underlying file.
+func (w *WavReader) Close() error {
+	return w.file.Close()
+}
 
-	for i := 0; i < numSamples; i++ {
-		sample := int16(binary.LittleEndian.Uint16(wavData[i*2 : i*2+2]))
-		samples[i] = float64(sample) / 32768.0 // normalize to [-1.0, 1.0]
+// WriteWavFile writes raw little-endian PCM data to fileName behind a
+// standard 44-byte header.
+func WriteWavFile(fileName string, data []byte, sampleRate, channels, bitsPerSample int) error {
+	blockAlign := channels * bitsPerSample / 8
+	header := WavHeader{
+		ChunkID:       [4]byte{'R', 'I', 'F', 'F'},
+		ChunkSize:     uint32(36 + len(data)),
+		Format:        [4]byte{'W', 'A', 'V', 'E'},
+		Subchunk1ID:   [4]byte{'f', 'm', 't', ' '},
+		Subchunk1Size: 16,
+		AudioFormat:   1,
+		NumChannels:   uint16(channels),
+		SampleRate:    uint32(sampleRate),
+		ByteRate:      uint32(sampleRate * blockAlign),
+		BlockAlign:    uint16(blockAlign),
+		BitsPerSample: uint16(bitsPerSample),
+		Subchunk2ID:   [4]byte{'d', 'a', 't', 'a'},
+		Subchunk2Size: uint32(len(data)),
 	}
 
-	return samples, nil
+	file, err := os.Create(fileName)
+	if err != nil {
+		return err
+	}
+	if err := binary.Write(file, binary.LittleEndian, header); err != nil {
+		file.Close()
+		return err
+	}
+	if _, err := file.Write(data); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// ConvertWavDataToSamples converts interleaved 16-bit PCM data with the
+// given number of channels to mono float samples normalised to [-1.0, 1.0].
+func ConvertWavDataToSamples(wavData []byte, channels int, downmix Downmix) ([]float64, error) {
+	interleaved, err := DecodeWavData(wavData, WaveFormatPCM, 16)
+	if err != nil {
+		return nil, err
+	}
+	return DownmixSamples(interleaved, channels, downmix)
 }
@@ -22,7 +22,7 @@ func init() {
 
 func main() {
 	// Entry point of the server application
-	err := utils.CreateDirIfNotExist("temporary_files")
+	err := utils.CreateDirIfNotExist(handlers.TEMP_DIR)
 	if err != nil {
 		logger := utils.GetLogger()
 		ctx := context.Background()
@@ -30,7 +30,7 @@ func main() {
 	}
 
 	if len(os.Args) < 2 {
-		fmt.Println("Expected at least one arguement of the following: 'find', 'download', 'save', 'erase', 'serve'")
+		fmt.Println("Expected at least one arguement of the following: 'search', 'download', 'save', 'erase', 'reindex', 'serve', 'migrate'")
 		fmt.Println("Example: go run main.go <arguement>")
 
 		os.Exit(1)
@@ -63,6 +63,35 @@ func main() {
 		}
 		path := os.Args[2]
 		handlers.Search(path)
+
+	case "migrate":
+		if len(os.Args) < 3 {
+			fmt.Println("Expected one of 'up', 'down' or 'status' after 'migrate'.")
+			fmt.Println("Example: go run main.go migrate up")
+			os.Exit(1)
+		}
+		handlers.Migrate(os.Args[2])
+
+	case "save":
+		if len(os.Args) < 3 {
+			fmt.Println("Expected a file or directory after 'save'.")
+			fmt.Println("Example: go run main.go save path/to/music")
+			os.Exit(1)
+		}
+		handlers.Save(os.Args[2])
+
+	case "erase":
+		handlers.Erase(os.Args[2:])
+
+	case "reindex":
+		handlers.Reindex()
+
+	case "serve":
+		port := utils.GetEnv("PORT", "8080")
+		if len(os.Args) > 2 {
+			port = os.Args[2]
+		}
+		handlers.Serve(":" + port)
 	}
 
 }
@@ -12,3 +12,11 @@ type Couple struct {
 	SongID     string `json:"song_id"`
 	AnchorTime uint32 `json:"anchor_time"`
 }
+
+// Fingerprint is one hash and where it occurs. A song may contain the same
+// hash at several anchor times, so fingerprints are kept as a list rather
+// than keyed by hash.
+type Fingerprint struct {
+	Hash uint32 `json:"hash"`
+	Couple
+}
@@ -177,8 +177,8 @@ func PrintLongVals(dataset interface{}, filename string) {
 
 // SaveSpectrogramImage saves spectrogram as grayscale or heatmap
 func SaveSpectrogramWithLabels(spectrogram [][]complex128, filename string, sampleRate, hopSize int, trackDuration float64, colored bool) error {
-	height := len(spectrogram[0]) / 2 // frequency bins
-	width := len(spectrogram)         // time frames
+	height := len(spectrogram[0]) // frequency bins, DC to Nyquist
+	width := len(spectrogram)     // time frames
 
 	// Step 1: create spectrogram as image
 	img := image.NewRGBA(image.Rect(0, 0, width, height))